@@ -1,8 +1,10 @@
 package safemap
 
 import (
+	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -71,6 +73,15 @@ func Benchmark_Single_Get_SafeMap(b *testing.B) {
 	}
 }
 
+func Benchmark_Single_Get_SafeMapSpinLock(b *testing.B) {
+	m, _ := NewMap[string, string](HashStrKeyFunc(), WithSpinLock[string]())
+	m.Set(data.key, data.val)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Get(data.key)
+	}
+}
+
 func Benchmark_Single_Get_SyncMap(b *testing.B) {
 	var m sync.Map
 	m.Store(data.key, data.val)
@@ -106,6 +117,23 @@ func Benchmark_Single_Set_SafeMap(b *testing.B) {
 	}
 }
 
+func Benchmark_Single_Set_SafeMapSpinLock(b *testing.B) {
+	m, _ := NewMap[string, string](HashStrKeyFunc(), WithSpinLock[string]())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Set(data.key, data.val)
+	}
+}
+
+func Benchmark_Single_Set_SafeMapUnsafe(b *testing.B) {
+	m, _ := NewMap[string, string](HashStrKeyFunc())
+	u := m.Unsafe()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		u.Set(data.key, data.val)
+	}
+}
+
 func Benchmark_Single_Set_SyncMap(b *testing.B) {
 	var m sync.Map
 	b.ResetTimer()
@@ -242,6 +270,105 @@ func Benchmark_Concurrent_Set_SingleRwLock(b *testing.B) {
 	}
 }
 
+var parallelKeys = func() []string {
+	keys := make([]string, 1<<12)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	return keys
+}()
+
+func Benchmark_Parallel_Get_SafeMap(b *testing.B) {
+	benchmarkParallelGet(b)
+}
+
+func Benchmark_Parallel_Get_SafeMapSpinLock(b *testing.B) {
+	benchmarkParallelGet(b, WithSpinLock[string]())
+}
+
+func benchmarkParallelGet(b *testing.B, options ...OptFunc[string]) {
+	m, _ := NewMap[string, string](append(options, HashStrKeyFunc())...)
+	for _, key := range parallelKeys {
+		m.Set(key, data.val)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			m.Get(parallelKeys[i&(len(parallelKeys)-1)])
+			i++
+		}
+	})
+}
+
+func Benchmark_Parallel_Set_SafeMap(b *testing.B) {
+	m, _ := NewMap[string, string](HashStrKeyFunc())
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			m.Set(parallelKeys[i&(len(parallelKeys)-1)], data.val)
+			i++
+		}
+	})
+}
+
+// Benchmark_Parallel_Set_SharedCounter adds a shared atomic counter update
+// to every Set, as SafeMap did before counters moved into the buckets.
+func Benchmark_Parallel_Set_SharedCounter(b *testing.B) {
+	m, _ := NewMap[string, string](HashStrKeyFunc())
+	var count int32
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			m.Set(parallelKeys[i&(len(parallelKeys)-1)], data.val)
+			atomic.AddInt32(&count, 1)
+			i++
+		}
+	})
+}
+
+// benchmarkSetDuringRange measures Set while another goroutine keeps
+// ranging over the map with rangeFunc
+func benchmarkSetDuringRange(b *testing.B, rangeFunc func(m *SafeMap[string, string], f func(k, v string) bool)) {
+	m, _ := NewMap[string, string](HashStrKeyFunc())
+	for _, key := range parallelKeys {
+		m.Set(key, data.val)
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			rangeFunc(m, func(k, v string) bool {
+				runtime.Gosched()
+				return true
+			})
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Set(parallelKeys[i&(len(parallelKeys)-1)], data.val)
+	}
+	b.StopTimer()
+	close(stop)
+	wg.Wait()
+}
+
+func Benchmark_Concurrent_SetDuringRange_SafeMap(b *testing.B) {
+	benchmarkSetDuringRange(b, (*SafeMap[string, string]).Range)
+}
+
+func Benchmark_Concurrent_SetDuringRangeSnapshot_SafeMap(b *testing.B) {
+	benchmarkSetDuringRange(b, (*SafeMap[string, string]).RangeSnapshot)
+}
+
 func Benchmark_Bucket1_Get_SafeMap(b *testing.B) {
 	m := NewStringMap[string, string](WithBuckets[string](1))
 	ch := make(chan struct{}, b.N)
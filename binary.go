@@ -0,0 +1,81 @@
+package safemap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+//
+// The encoding is the entry count as a uvarint, followed by each key and
+// its value encoded with a single gob stream, so type information is
+// written only once. Keys and values must be gob-encodable; interface
+// types need gob.Register. The entries are copied while all buckets are
+// read-locked, so the result is a point-in-time snapshot of the map.
+// Like UnmarshalBinary, a zero SafeMap returns ErrMissingHashFunc.
+func (m *SafeMap[K, V]) MarshalBinary() ([]byte, error) {
+	if m.table.Load() == nil {
+		return nil, ErrMissingHashFunc
+	}
+	t := m.pinTable()
+	t.allRLock()
+	keys := make([]K, 0, t.lockedLen())
+	vals := make([]V, 0, cap(keys))
+	for i := 0; i < t.bucketTotal; i++ {
+		for key, val := range t.buckets[i].innerMap {
+			keys = append(keys, key)
+			vals = append(vals, val)
+		}
+	}
+	t.allRUnlock()
+	m.unpinTable()
+
+	var buf bytes.Buffer
+	buf.Write(binary.AppendUvarint(nil, uint64(len(keys))))
+	enc := gob.NewEncoder(&buf)
+	for i := range keys {
+		if err := enc.Encode(keys[i]); err != nil {
+			return nil, err
+		}
+		if err := enc.Encode(vals[i]); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, replacing the
+// map's entries with those decoded from data as written by MarshalBinary.
+// The map must have been created with a constructor, since keys are
+// sharded with its hash function; a zero SafeMap returns
+// ErrMissingHashFunc. Data that is not a valid encoding returns
+// ErrInvalidEncoding or a gob error, and leaves the map unchanged.
+func (m *SafeMap[K, V]) UnmarshalBinary(data []byte) error {
+	if m.table.Load() == nil {
+		return ErrMissingHashFunc
+	}
+	n, size := binary.Uvarint(data)
+	// every key and value takes at least a byte, which bounds the
+	// allocation below for corrupt counts
+	if size <= 0 || n > uint64(len(data)-size)/2 {
+		return ErrInvalidEncoding
+	}
+	dec := gob.NewDecoder(bytes.NewReader(data[size:]))
+	keys := make([]K, n)
+	vals := make([]V, n)
+	for i := range keys {
+		if err := dec.Decode(&keys[i]); err != nil {
+			return err
+		}
+		if err := dec.Decode(&vals[i]); err != nil {
+			return err
+		}
+	}
+
+	m.Clear()
+	for i := range keys {
+		m.Set(keys[i], vals[i])
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package safemap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	m := NewStringMap[string, int]()
+	for i, key := range []string{"a", "b", "c"} {
+		m.Set(key, i)
+	}
+	data, err := m.MarshalBinary()
+	assert.Nil(t, err)
+
+	got := NewStringMap[string, int]()
+	got.Set("stale", 1)
+	assert.Nil(t, got.UnmarshalBinary(data))
+	assert.Equal(t, m.ToMap(), got.ToMap())
+
+	n := NewIntegerMap[int, string]()
+	for i := -50; i < 50; i++ {
+		n.Set(i, string(rune('a'+i+50)))
+	}
+	data, err = n.MarshalBinary()
+	assert.Nil(t, err)
+	gotInt := NewIntegerMap[int, string](WithBuckets[int](2))
+	assert.Nil(t, gotInt.UnmarshalBinary(data))
+	assert.Equal(t, n.ToMap(), gotInt.ToMap())
+
+	// empty maps
+	data, err = NewStringMap[string, int]().MarshalBinary()
+	assert.Nil(t, err)
+	assert.Nil(t, got.UnmarshalBinary(data))
+	assert.True(t, got.IsEmpty())
+
+	// a zero SafeMap has no table to encode
+	var zero SafeMap[string, int]
+	_, err = zero.MarshalBinary()
+	assert.ErrorIs(t, err, ErrMissingHashFunc)
+}
+
+func TestUnmarshalBinaryInvalid(t *testing.T) {
+	m := NewStringMap[string, int]()
+	m.Set("a", 1)
+
+	assert.ErrorIs(t, m.UnmarshalBinary(nil), ErrInvalidEncoding)
+	assert.ErrorIs(t, m.UnmarshalBinary([]byte{0xff, 0xff, 0xff, 0xff, 0x0f}), ErrInvalidEncoding)
+	assert.NotNil(t, m.UnmarshalBinary([]byte{1, 0, 0}))
+	assert.Equal(t, map[string]int{"a": 1}, m.ToMap())
+
+	var zero SafeMap[string, int]
+	assert.ErrorIs(t, zero.UnmarshalBinary([]byte{0}), ErrMissingHashFunc)
+}
@@ -0,0 +1,88 @@
+package safemap
+
+import "time"
+
+// expiry is the scheduled removal of an entry stored by GetOrSetWithExpiry.
+// Its timer removes the entry only while the expiry is still registered
+// for the key in the bucket's expiries, so an expiry that was cancelled
+// or replaced by Touch is a no-op even if its timer has already fired.
+type expiry struct {
+	ttl   time.Duration
+	timer *time.Timer
+}
+
+// scheduleExpiry registers a removal of key after ttl.
+// The caller must hold the bucket write lock.
+func (m *SafeMap[K, V]) scheduleExpiry(bucket *bucketMap[K, V], key K, ttl time.Duration) {
+	e := &expiry{ttl: ttl}
+	e.timer = time.AfterFunc(ttl, func() { m.expire(key, e) })
+	if bucket.expiries == nil {
+		bucket.expiries = make(map[K]*expiry)
+	}
+	bucket.expiries[key] = e
+}
+
+// expire removes key if e is still its registered expiry
+func (m *SafeMap[K, V]) expire(key K, e *expiry) {
+	bucket, t := m.lockKey(key)
+	if bucket.expiries[key] != e {
+		bucket.Unlock()
+		return
+	}
+	delete(bucket.expiries, key)
+	if _, b := bucket.innerMap[key]; b {
+		delete(bucket.innerMap, key)
+		bucket.count--
+		bucket.Unlock()
+		t.notifyDelete(key)
+		return
+	}
+	bucket.Unlock()
+}
+
+// cancelExpiry drops the expiry of key, if any.
+// The caller must hold the bucket write lock.
+func (bucket *bucketMap[K, V]) cancelExpiry(key K) {
+	if e, b := bucket.expiries[key]; b {
+		e.timer.Stop()
+		delete(bucket.expiries, key)
+	}
+}
+
+// cancelExpiries drops all expiries of the bucket.
+// The caller must hold the bucket write lock.
+func (bucket *bucketMap[K, V]) cancelExpiries() {
+	for _, e := range bucket.expiries {
+		e.timer.Stop()
+	}
+	bucket.expiries = nil
+}
+
+// GetOrSetWithExpiry is like GetOrSet, but when it stores val it also
+// schedules the entry's removal after ttl. Until then, GetOrSet and
+// GetOrSetWithExpiry return the stored value as loaded, and Touch pushes
+// the removal back to ttl from the time of the call.
+//
+// The expiry belongs to the entry: deleting the key cancels it, while
+// overwriting the value with Set keeps it. Expired entries are removed by
+// a timer, which calls the OnDelete observer like Delete does.
+func (m *SafeMap[K, V]) GetOrSetWithExpiry(key K, val V, ttl time.Duration) (V, bool) {
+	bucket, t := m.lockKey(key)
+	t.metrics.addSet()
+	if val, b := bucket.innerMap[key]; b {
+		val = t.read(val)
+		bucket.Unlock()
+		return val, true
+	}
+
+	bucket.innerMap[key] = val
+	bucket.count++
+	m.scheduleExpiry(bucket, key, ttl)
+	grow := t.overloaded(bucket)
+	bucket.Unlock()
+	t.notifySet(key)
+	if grow {
+		m.grow(t)
+	}
+	return val, false
+}
@@ -0,0 +1,100 @@
+package safemap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOrSetWithExpiry(t *testing.T) {
+	deleted := make(chan string, 1)
+	m := NewStringMap[string, int](WithOnDelete(func(key string) { deleted <- key }))
+
+	val, loaded := m.GetOrSetWithExpiry("a", 1, 50*time.Millisecond)
+	assert.False(t, loaded)
+	assert.Equal(t, 1, val)
+
+	// the cached value is loaded until it expires
+	val, loaded = m.GetOrSet("a", 2)
+	assert.True(t, loaded)
+	assert.Equal(t, 1, val)
+	val, loaded = m.GetOrSetWithExpiry("a", 3, time.Hour)
+	assert.True(t, loaded)
+	assert.Equal(t, 1, val)
+
+	select {
+	case key := <-deleted:
+		assert.Equal(t, "a", key)
+	case <-time.After(2 * time.Second):
+		t.Fatal("entry did not expire")
+	}
+	assert.False(t, m.Contains("a"))
+	assert.Equal(t, 0, m.Len())
+
+	// an existing key is loaded and gets no expiry
+	m.Set("b", 1)
+	val, loaded = m.GetOrSetWithExpiry("b", 2, time.Millisecond)
+	assert.True(t, loaded)
+	assert.Equal(t, 1, val)
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, m.Contains("b"))
+}
+
+func TestGetOrSetWithExpiryCancel(t *testing.T) {
+	m := NewStringMap[string, int]()
+
+	// deleting the entry cancels its expiry
+	m.GetOrSetWithExpiry("b", 1, 20*time.Millisecond)
+	m.Clear()
+	m.Set("b", 2)
+	m.GetOrSetWithExpiry("a", 1, 20*time.Millisecond)
+	m.Delete("a")
+	m.Set("a", 2)
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, m.Contains("a"))
+	assert.True(t, m.Contains("b"))
+	assert.Empty(t, m.table.Load().buckets[m.hashIndex("a")].expiries)
+}
+
+func TestTouchExtendsExpiry(t *testing.T) {
+	m := NewStringMap[string, int]()
+	const ttl = 200 * time.Millisecond
+	m.GetOrSetWithExpiry("a", 1, ttl)
+
+	time.Sleep(ttl * 3 / 5)
+	assert.True(t, m.Touch("a"))
+	time.Sleep(ttl * 3 / 5)
+	// past the original deadline, but within the touched one
+	assert.True(t, m.Contains("a"))
+
+	assert.Eventually(t, func() bool { return !m.Contains("a") }, 2*time.Second, 10*time.Millisecond)
+	assert.False(t, m.Touch("a"))
+}
+
+func TestExpirySurvivesGrowth(t *testing.T) {
+	m := NewIntegerMap[int, int](WithBuckets[int](0), WithLoadFactor[int](4))
+	m.GetOrSetWithExpiry(-1, 1, 50*time.Millisecond)
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	assert.Greater(t, m.BucketCount(), 1)
+	assert.Eventually(t, func() bool { return !m.Contains(-1) }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 100, m.Len())
+}
+
+func TestRenameExpiry(t *testing.T) {
+	m := NewStringMap[string, int]()
+
+	// the renamed value takes neither key's expiry with it
+	m.GetOrSetWithExpiry("old", 1, 20*time.Millisecond)
+	m.GetOrSetWithExpiry("new", 2, 20*time.Millisecond)
+	assert.True(t, m.Rename("old", "new"))
+	time.Sleep(60 * time.Millisecond)
+	val, ok := m.Get("new")
+	assert.True(t, ok)
+	assert.Equal(t, 1, val)
+	assert.False(t, m.Contains("old"))
+	assert.Empty(t, m.table.Load().buckets[m.hashIndex("new")].expiries)
+	assert.Empty(t, m.table.Load().buckets[m.hashIndex("old")].expiries)
+}
@@ -0,0 +1,77 @@
+package safemap
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// bucketLock is the lock of a bucket: a sync.RWMutex, or with WithSpinLock
+// a spinning reader-writer lock. The kind is fixed when the bucket is
+// created, so the branch on it is perfectly predictable.
+type bucketLock struct {
+	mu   sync.RWMutex
+	spin bool
+	// state is the spinlock word: -1 while write-locked, otherwise the
+	// number of readers holding the lock
+	state atomic.Int32
+	// writers is the number of writers waiting for the spinlock; readers
+	// back off while it is non-zero so that writers are not starved
+	writers atomic.Int32
+}
+
+func (l *bucketLock) Lock() {
+	if !l.spin {
+		l.mu.Lock()
+		return
+	}
+	l.writers.Add(1)
+	for !l.state.CompareAndSwap(0, -1) {
+		runtime.Gosched()
+	}
+	l.writers.Add(-1)
+}
+
+func (l *bucketLock) TryLock() bool {
+	if !l.spin {
+		return l.mu.TryLock()
+	}
+	return l.state.CompareAndSwap(0, -1)
+}
+
+func (l *bucketLock) Unlock() {
+	if !l.spin {
+		l.mu.Unlock()
+		return
+	}
+	l.state.Store(0)
+}
+
+func (l *bucketLock) RLock() {
+	if !l.spin {
+		l.mu.RLock()
+		return
+	}
+	for !l.TryRLock() {
+		runtime.Gosched()
+	}
+}
+
+func (l *bucketLock) TryRLock() bool {
+	if !l.spin {
+		return l.mu.TryRLock()
+	}
+	if l.writers.Load() != 0 {
+		return false
+	}
+	s := l.state.Load()
+	return s >= 0 && l.state.CompareAndSwap(s, s+1)
+}
+
+func (l *bucketLock) RUnlock() {
+	if !l.spin {
+		l.mu.RUnlock()
+		return
+	}
+	l.state.Add(-1)
+}
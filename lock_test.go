@@ -0,0 +1,79 @@
+package safemap
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpinLock(t *testing.T) {
+	l := &bucketLock{spin: true}
+	l.Lock()
+	assert.False(t, l.TryLock())
+	assert.False(t, l.TryRLock())
+	l.Unlock()
+
+	l.RLock()
+	assert.True(t, l.TryRLock())
+	assert.False(t, l.TryLock())
+	l.RUnlock()
+	l.RUnlock()
+	assert.True(t, l.TryLock())
+	l.Unlock()
+
+	// readers and writers exclude each other
+	n := 0
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if g%2 == 0 {
+					l.Lock()
+					n++
+					l.Unlock()
+				} else {
+					l.RLock()
+					if n > 4000 {
+						t.Errorf("n = %d, want at most 4000", n)
+					}
+					l.RUnlock()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.Equal(t, 4000, n)
+}
+
+func TestWithSpinLock(t *testing.T) {
+	m := NewIntegerMap[int, int](WithSpinLock[int](), WithBuckets[int](1), WithLoadFactor[int](64))
+	for _, bucket := range m.table.Load().buckets {
+		assert.True(t, bucket.spin)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				m.Set(g*1000+i, i)
+				m.Get(i)
+				Incr(m, -1, 1)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 4001, m.Len())
+	val, _ := m.Get(-1)
+	assert.Equal(t, 4000, val)
+	// buckets created by growth keep the spinlock
+	assert.Greater(t, m.BucketCount(), 2)
+	for _, bucket := range m.table.Load().buckets {
+		assert.True(t, bucket.spin)
+	}
+}
@@ -1,25 +1,81 @@
 package safemap
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
+	"unsafe"
 
 	"golang.org/x/exp/constraints"
 )
 
-var ErrMissingHashFunc = errors.New("hash function is required")
+var (
+	ErrMissingHashFunc     = errors.New("hash function is required")
+	ErrKeyNotInTransaction = errors.New("key is not part of the transaction")
+	ErrInvalidEncoding     = errors.New("invalid binary map encoding")
+	ErrInvalidBuckets      = errors.New("invalid buckets mask")
+	ErrBucketOutOfRange    = errors.New("bucket index out of range")
+	ErrPoorHashFunc        = errors.New("hash function spreads keys over too few buckets")
+	ErrValueCopierType     = errors.New("value copier does not match the map's value type")
+)
 
 const (
 	// default buckets count
 	defaultBucketCount = 1 << 5
+	// max buckets count mask
+	maxBucketMask = 10
 	// max buckets count
-	maxBucketCount = 1 << 10
+	maxBucketCount = 1 << maxBucketMask
+	// max entries rendered by String
+	maxStringEntries = 64
+	// attempts to read-lock a bucket in String before skipping it
+	stringLockAttempts = 100
+	// entries visited between context checks within a bucket
+	ctxCheckInterval = 1 << 10
+	// approximate size of a runtime map header
+	mapHeaderSize = 48
+	// max age of the length cached for ApproxLen
+	approxLenInterval = 100 * time.Millisecond
+	// min fraction, as 1/n, of the reachable buckets that ValidateHashFunc
+	// expects distinct sample keys to occupy
+	minHashSpread = 4
+	// interval at which ClearContext retries a held bucket lock
+	clearPollInterval = 100 * time.Microsecond
+	// interval at which Reset retries pinning the table exclusively
+	resetPollInterval = 100 * time.Microsecond
 )
 
 type bucketMap[K comparable, V any] struct {
-	sync.RWMutex
+	bucketLock
 	innerMap map[K]V
+	// count is the number of entries in innerMap, guarded by the bucket lock.
+	// Keeping it per bucket avoids a shared counter that every write
+	// across all buckets would contend on.
+	count int
+	// stale is set, under the bucket lock, once the bucket's table has been
+	// replaced; its entries have moved to the new table.
+	stale bool
+	// expiries holds the scheduled removals of entries stored with
+	// GetOrSetWithExpiry; it is nil until the first one
+	expiries map[K]*expiry
+}
+
+// bucketTable is a fixed set of buckets together with the options that
+// shard keys into them. A SafeMap replaces its table as a whole when it
+// grows, and never modifies the bucket slice of a published table.
+type bucketTable[K comparable, V any] struct {
+	buckets []*bucketMap[K, V]
+	*options[K]
+	// growAt is the bucket size above which a write triggers a growth check
+	growAt atomic.Int64
+	// copyValue is the WithValueCopier copier, or nil
+	copyValue func(V) V
 }
 
 // SafeMap is a thread-safe, generic map with configurable options.
@@ -31,11 +87,14 @@ type bucketMap[K comparable, V any] struct {
 // The map is designed for high-concurrency scenarios where
 // thread safety and performance are important considerations.
 //
-// As you use this map, you must be create it with NewMap/NewStringMap/NewIntegerMap function.
+// As you use this map, you must be create it with NewMap/NewStringMap/NewIntegerMap/NewFloatMap function.
 type SafeMap[K comparable, V any] struct {
-	count   int32
-	buckets []*bucketMap[K, V]
-	*options[K]
+	table atomic.Pointer[bucketTable[K, V]]
+	// resizeMu is read-locked by operations that span several buckets, which
+	// keeps the table fixed while they run, and write-locked to replace it.
+	// Single-key operations don't take it; they detect a replaced table
+	// through the stale flag of the bucket they locked.
+	resizeMu sync.RWMutex
 }
 
 // NewMap creates a new thread-safe, generic map with configurable options.
@@ -66,28 +125,77 @@ func NewMap[K comparable, V any](options ...OptFunc[K]) (*SafeMap[K, V], error)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkValueCopier[K, V](opt); err != nil {
+		return nil, err
+	}
+
+	m := &SafeMap[K, V]{}
+	m.table.Store(newTable[K, V](opt))
+	return m, nil
+}
 
-	m := &SafeMap[K, V]{
+// checkValueCopier returns ErrValueCopierType if opt holds a value copier
+// for a value type other than V
+func checkValueCopier[K comparable, V any](opt *options[K]) error {
+	if opt.valueCopier == nil {
+		return nil
+	}
+	if _, b := opt.valueCopier.(func(V) V); !b {
+		return fmt.Errorf("%w: %T", ErrValueCopierType, opt.valueCopier)
+	}
+	return nil
+}
+
+// newTable returns a table of opt.bucketTotal empty buckets
+func newTable[K comparable, V any](opt *options[K]) *bucketTable[K, V] {
+	t := &bucketTable[K, V]{
 		buckets: make([]*bucketMap[K, V], opt.bucketTotal),
 		options: opt,
-		count:   0,
 	}
+	t.copyValue, _ = opt.valueCopier.(func(V) V)
+	for i := 0; i < t.bucketTotal; i++ {
+		t.buckets[i] = &bucketMap[K, V]{innerMap: make(map[K]V)}
+		t.buckets[i].spin = opt.spinLock
+	}
+	if t.loadFactor > 0 && t.bucketTotal < maxBucketCount {
+		t.growAt.Store(int64(t.loadFactor))
+	} else {
+		t.growAt.Store(math.MaxInt64)
+	}
+	return t
+}
 
-	for i := 0; i < m.bucketTotal; i++ {
-		m.buckets[i] = &bucketMap[K, V]{innerMap: make(map[K]V)}
+// mustNewMap is NewMap for the constructors that set the hash function
+// themselves and have no error to return. NewMap can then only fail on an
+// invalid option, such as an out-of-range WithBucketsE mask or a
+// mismatched WithValueCopier, which is reported here by panicking with
+// the wrapped error rather than by a nil map that panics on first use.
+func mustNewMap[K comparable, V any](options ...OptFunc[K]) *SafeMap[K, V] {
+	m, err := NewMap[K, V](options...)
+	if err != nil {
+		panic(fmt.Errorf("safemap: %w", err))
 	}
+	return m
+}
 
-	return m, nil
+// NewMapOf returns a new SafeMap for any comparable key type, hashed with
+// DefaultHashFunc, which picks a hash from the kind of K. Unlike the other
+// constructors, a WithHashFunc among options overrides the default.
+// It panics on an invalid option.
+func NewMapOf[K comparable, V any](options ...OptFunc[K]) *SafeMap[K, V] {
+	options = append([]OptFunc[K]{WithHashFunc(DefaultHashFunc[K]())}, options...)
+	return mustNewMap[K, V](options...)
 }
 
-// NewStringMap returns a new string generic key SafeMap
+// NewStringMap returns a new string generic key SafeMap.
+// It panics on an invalid option.
 func NewStringMap[K ~string, V any](options ...OptFunc[K]) *SafeMap[K, V] {
 	options = append(options, WithHashFunc(func(k K) uint64 { return Hashstr(string(k)) }))
-	m, _ := NewMap[K, V](options...)
-	return m
+	return mustNewMap[K, V](options...)
 }
 
-// NewIntegerMap returns a new integer generic key SafeMap
+// NewIntegerMap returns a new integer generic key SafeMap.
+// It panics on an invalid option.
 func NewIntegerMap[K constraints.Integer, V any](options ...OptFunc[K]) *SafeMap[K, V] {
 	options = append(options, WithHashFunc(func(k K) uint64 {
 		if k < 0 {
@@ -95,126 +203,1688 @@ func NewIntegerMap[K constraints.Integer, V any](options ...OptFunc[K]) *SafeMap
 		}
 		return uint64(k)
 	}))
-	m, _ := NewMap[K, V](options...)
+	return mustNewMap[K, V](options...)
+}
+
+// NewFloatMap returns a new float generic key SafeMap.
+//
+// Keys are hashed by their bit pattern, with -0 and +0 treated as the same
+// key. Since NaN != NaN, an entry stored under a NaN key can never be
+// retrieved or deleted; every Set with a NaN key adds a new entry.
+// It panics on an invalid option.
+func NewFloatMap[K constraints.Float, V any](options ...OptFunc[K]) *SafeMap[K, V] {
+	options = append(options, WithHashFunc(func(k K) uint64 { return hashFloat(float64(k)) }))
+	return mustNewMap[K, V](options...)
+}
+
+// NewStructMap returns a new SafeMap for comparable struct keys, hashed
+// with HashStruct. It panics on an invalid option.
+func NewStructMap[K comparable, V any](options ...OptFunc[K]) *SafeMap[K, V] {
+	options = append(options, WithHashFunc(HashStruct[K]()))
+	return mustNewMap[K, V](options...)
+}
+
+// FromMap returns a new SafeMap holding all entries of src.
+// Like NewMap, it returns ErrMissingHashFunc if no hash function is set.
+func FromMap[K comparable, V any](src map[K]V, options ...OptFunc[K]) (*SafeMap[K, V], error) {
+	m, err := NewMap[K, V](options...)
+	if err != nil {
+		return nil, err
+	}
+	for key, val := range src {
+		m.Set(key, val)
+	}
+	return m, nil
+}
+
+// FromStringMap returns a new string generic key SafeMap holding all entries of src
+func FromStringMap[K ~string, V any](src map[K]V, options ...OptFunc[K]) *SafeMap[K, V] {
+	m := NewStringMap[K, V](options...)
+	for key, val := range src {
+		m.Set(key, val)
+	}
+	return m
+}
+
+// FromIntegerMap returns a new integer generic key SafeMap holding all entries of src
+func FromIntegerMap[K constraints.Integer, V any](src map[K]V, options ...OptFunc[K]) *SafeMap[K, V] {
+	m := NewIntegerMap[K, V](options...)
+	for key, val := range src {
+		m.Set(key, val)
+	}
 	return m
 }
 
+// index returns key's bucket index
+func (t *bucketTable[K, V]) index(key K) int {
+	h := t.hashFunc(key)
+	if t.shardFunc != nil {
+		return t.shardFunc(h, t.bucketTotal)
+	}
+	return int(h & uint64(t.bucketTotal-1))
+}
+
+// read returns val as handed to readers: a copy if the map has a value
+// copier. The caller must hold the lock of the bucket holding val.
+func (t *bucketTable[K, V]) read(val V) V {
+	if t.copyValue == nil {
+		return val
+	}
+	return t.copyValue(val)
+}
+
 // hashIndex returns key's lock index
 func (m *SafeMap[K, V]) hashIndex(key K) int {
-	return int(m.hashFunc(key) & uint64(m.bucketTotal-1))
+	return m.table.Load().index(key)
+}
+
+// lockKey write-locks the bucket holding key and returns it with its table
+func (m *SafeMap[K, V]) lockKey(key K) (*bucketMap[K, V], *bucketTable[K, V]) {
+	for {
+		t := m.table.Load()
+		bucket := t.buckets[t.index(key)]
+		t.metrics.lock(&bucket.bucketLock)
+		if !bucket.stale {
+			return bucket, t
+		}
+		bucket.Unlock()
+	}
+}
+
+// rlockKey read-locks the bucket holding key and returns it with its table
+func (m *SafeMap[K, V]) rlockKey(key K) (*bucketMap[K, V], *bucketTable[K, V]) {
+	for {
+		t := m.table.Load()
+		bucket := t.buckets[t.index(key)]
+		t.metrics.rlock(&bucket.bucketLock)
+		if !bucket.stale {
+			return bucket, t
+		}
+		bucket.RUnlock()
+	}
+}
+
+// pinTable returns the current table and keeps it from being replaced
+// until unpinTable is called
+func (m *SafeMap[K, V]) pinTable() *bucketTable[K, V] {
+	m.resizeMu.RLock()
+	return m.table.Load()
+}
+
+// unpinTable releases the table pinned by pinTable
+func (m *SafeMap[K, V]) unpinTable() {
+	m.resizeMu.RUnlock()
 }
 
 // allLock locks all buckets
-func (m *SafeMap[K, V]) allLock() {
-	for i := 0; i < m.bucketTotal; i++ {
-		m.buckets[i].Lock()
+func (t *bucketTable[K, V]) allLock() {
+	for i := 0; i < t.bucketTotal; i++ {
+		t.buckets[i].Lock()
 	}
 }
 
 // allUnlock unlocks all buckets
-func (m *SafeMap[K, V]) allUnlock() {
-	for i := 0; i < m.bucketTotal; i++ {
-		m.buckets[i].Unlock()
+func (t *bucketTable[K, V]) allUnlock() {
+	for i := 0; i < t.bucketTotal; i++ {
+		t.buckets[i].Unlock()
+	}
+}
+
+// allRLock read-locks all buckets
+func (t *bucketTable[K, V]) allRLock() {
+	for i := 0; i < t.bucketTotal; i++ {
+		t.buckets[i].RLock()
+	}
+}
+
+// allRUnlock read-unlocks all buckets
+func (t *bucketTable[K, V]) allRUnlock() {
+	for i := 0; i < t.bucketTotal; i++ {
+		t.buckets[i].RUnlock()
+	}
+}
+
+// lockPair pins the tables of a and b and read-locks all their buckets,
+// always locking the map with the lower address first so that concurrent
+// calls on the same pair of maps cannot deadlock.
+func lockPair[K comparable, V any](a, b *SafeMap[K, V]) (ta, tb *bucketTable[K, V]) {
+	first, second := a, b
+	if uintptr(unsafe.Pointer(a)) > uintptr(unsafe.Pointer(b)) {
+		first, second = b, a
+	}
+	tf, ts := first.pinTable(), second.pinTable()
+	tf.allRLock()
+	ts.allRLock()
+	if first == a {
+		return tf, ts
+	}
+	return ts, tf
+}
+
+// unlockPair releases the locks taken by lockPair
+func unlockPair[K comparable, V any](a, b *SafeMap[K, V], ta, tb *bucketTable[K, V]) {
+	ta.allRUnlock()
+	a.unpinTable()
+	tb.allRUnlock()
+	b.unpinTable()
+}
+
+// indexes returns the sorted, distinct bucket indexes of keys
+func (t *bucketTable[K, V]) indexes(keys []K) []int {
+	set := make(map[int]struct{}, len(keys))
+	for _, key := range keys {
+		set[t.index(key)] = struct{}{}
+	}
+	indexes := make([]int, 0, len(set))
+	for i := range set {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// overloaded reports whether a write that left bucket at its current size
+// should trigger a growth check. The caller must hold the bucket lock.
+func (t *bucketTable[K, V]) overloaded(bucket *bucketMap[K, V]) bool {
+	return int64(bucket.count) > t.growAt.Load()
+}
+
+// grow replaces t with a table of twice or more the buckets once the
+// average bucket load exceeds the load factor. The new bucket count is the
+// smallest one that brings the load down to half the load factor, so the
+// map has to take in as many entries again before the next growth.
+//
+// grow gives up without waiting if the table is pinned by a multi-bucket
+// operation; a later write will trigger it again.
+func (m *SafeMap[K, V]) grow(t *bucketTable[K, V]) {
+	if !m.resizeMu.TryLock() {
+		return
+	}
+	defer m.resizeMu.Unlock()
+	if m.table.Load() != t {
+		return
+	}
+
+	t.allLock()
+	defer t.allUnlock()
+
+	n, largest := 0, 0
+	for i := 0; i < t.bucketTotal; i++ {
+		n += t.buckets[i].count
+		largest = max(largest, t.buckets[i].count)
+	}
+	if n <= t.loadFactor*t.bucketTotal {
+		// only some buckets are overloaded; raise the trigger so that writes
+		// to them don't re-check on every call
+		t.growAt.Store(int64(2 * largest))
+		return
+	}
+
+	opt := *t.options
+	for opt.bucketTotal < maxBucketCount && n > opt.loadFactor*opt.bucketTotal/2 {
+		opt.bucketTotal *= 2
+	}
+	grown := newTable[K, V](&opt)
+	for i := 0; i < t.bucketTotal; i++ {
+		for key, val := range t.buckets[i].innerMap {
+			bucket := grown.buckets[grown.index(key)]
+			bucket.innerMap[key] = val
+			bucket.count++
+		}
+		for key, e := range t.buckets[i].expiries {
+			bucket := grown.buckets[grown.index(key)]
+			if bucket.expiries == nil {
+				bucket.expiries = make(map[K]*expiry)
+			}
+			bucket.expiries[key] = e
+		}
+		t.buckets[i].stale = true
+	}
+	m.table.Store(grown)
+}
+
+// notifySet calls the OnSet observer, if any.
+// It must be called after the bucket lock is released.
+func (t *bucketTable[K, V]) notifySet(key K) {
+	if t.onSet != nil {
+		t.onSet(key)
+	}
+}
+
+// notifyDelete calls the OnDelete observer, if any.
+// It must be called after the bucket lock is released.
+func (t *bucketTable[K, V]) notifyDelete(key K) {
+	if t.onDelete != nil {
+		t.onDelete(key)
 	}
 }
 
 // Get returns key's value
 func (m *SafeMap[K, V]) Get(key K) (V, bool) {
-	index := m.hashIndex(key)
-	m.buckets[index].RLock()
-	val, b := m.buckets[index].innerMap[key]
-	m.buckets[index].RUnlock()
+	bucket, t := m.rlockKey(key)
+	t.metrics.addGet()
+	val, b := bucket.innerMap[key]
+	if b {
+		val = t.read(val)
+	}
+	bucket.RUnlock()
 	return val, b
 }
 
+// GetWithLock returns key's value and whether it is present, like Get, but
+// keeps the key's bucket read-locked until the returned unlock func is
+// called, so the entry cannot change while the caller acts on it. unlock
+// must be called exactly once; further calls are no-ops.
+//
+// Until unlock is called, writers to every key in the bucket block, and
+// the caller must not call any method of the map that locks the same
+// bucket: writes deadlock, and so can reads once a writer is waiting.
+// A forgotten unlock blocks the bucket's writers forever.
+func (m *SafeMap[K, V]) GetWithLock(key K) (V, bool, func()) {
+	bucket, t := m.rlockKey(key)
+	t.metrics.addGet()
+	val, b := bucket.innerMap[key]
+	if b {
+		val = t.read(val)
+	}
+	var once sync.Once
+	return val, b, func() { once.Do(bucket.RUnlock) }
+}
+
+// TryGet is Get without blocking: if key's bucket is write-locked, it
+// returns right away with acquired false, leaving the caller to treat the
+// key as a miss or retry later. Otherwise acquired is true and val and
+// found are as returned by Get.
+func (m *SafeMap[K, V]) TryGet(key K) (val V, found, acquired bool) {
+	for {
+		t := m.table.Load()
+		bucket := t.buckets[t.index(key)]
+		if !bucket.TryRLock() {
+			return val, false, false
+		}
+		if bucket.stale {
+			bucket.RUnlock()
+			continue
+		}
+		t.metrics.addGet()
+		val, found = bucket.innerMap[key]
+		if found {
+			val = t.read(val)
+		}
+		bucket.RUnlock()
+		return val, found, true
+	}
+}
+
+// GetMultiple returns the values of those keys that are present.
+// It read-locks every bucket holding one of keys, in ascending bucket
+// order, and reads all keys before releasing any lock, so the result is
+// consistent with writers that lock the same buckets, such as Transact.
+func (m *SafeMap[K, V]) GetMultiple(keys []K) map[K]V {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	indexes := t.indexes(keys)
+	for _, i := range indexes {
+		t.buckets[i].RLock()
+	}
+	res := make(map[K]V, len(keys))
+	for _, key := range keys {
+		if val, b := t.buckets[t.index(key)].innerMap[key]; b {
+			res[key] = t.read(val)
+		}
+	}
+	for _, i := range indexes {
+		t.buckets[i].RUnlock()
+	}
+	return res
+}
+
+// GetOrDefault returns key's value if present, and def otherwise.
+// It never modifies the map.
+func (m *SafeMap[K, V]) GetOrDefault(key K, def V) V {
+	bucket, t := m.rlockKey(key)
+	t.metrics.addGet()
+	val, b := bucket.innerMap[key]
+	if b {
+		val = t.read(val)
+	}
+	bucket.RUnlock()
+	if !b {
+		return def
+	}
+	return val
+}
+
+// Contains reports whether key is present, without copying its value
+func (m *SafeMap[K, V]) Contains(key K) bool {
+	bucket, t := m.rlockKey(key)
+	t.metrics.addGet()
+	_, b := bucket.innerMap[key]
+	bucket.RUnlock()
+	return b
+}
+
+// Touch reports whether key is present, without reading its value.
+// For an entry stored by GetOrSetWithExpiry, it also reschedules the
+// removal to the entry's ttl from now.
+func (m *SafeMap[K, V]) Touch(key K) bool {
+	bucket, _ := m.lockKey(key)
+	_, b := bucket.innerMap[key]
+	if e, ok := bucket.expiries[key]; b && ok {
+		e.timer.Stop()
+		m.scheduleExpiry(bucket, key, e.ttl)
+	}
+	bucket.Unlock()
+	return b
+}
+
 // Set sets key's value
 func (m *SafeMap[K, V]) Set(key K, val V) {
-	index := m.hashIndex(key)
-	m.buckets[index].Lock()
-	if _, b := m.buckets[index].innerMap[key]; !b {
-		atomic.AddInt32(&m.count, 1)
+	bucket, t := m.lockKey(key)
+	t.metrics.addSet()
+	if _, b := bucket.innerMap[key]; !b {
+		bucket.count++
+	}
+	bucket.innerMap[key] = val
+	grow := t.overloaded(bucket)
+	bucket.Unlock()
+	t.notifySet(key)
+	if grow {
+		m.grow(t)
 	}
-	m.buckets[index].innerMap[key] = val
-	m.buckets[index].Unlock()
+}
+
+// SetAll stores every entry of src, overwriting existing keys.
+// Keys are grouped by bucket and each bucket is locked once for all of its
+// keys, like IncrMany, which pays off over a Set loop when writers contend
+// for the buckets. The entries of one bucket are stored together, but
+// other buckets may be updated before or after them.
+func (m *SafeMap[K, V]) SetAll(src map[K]V) {
+	m.updateGrouped(src, func(bucket *bucketMap[K, V], e *Entry[K, V]) {
+		if _, b := bucket.innerMap[e.Key]; !b {
+			bucket.count++
+		}
+		bucket.innerMap[e.Key] = e.Value
+	})
 }
 
 func (m *SafeMap[K, V]) Delete(key K) {
-	index := m.hashIndex(key)
-	m.buckets[index].Lock()
-	if _, b := m.buckets[index].innerMap[key]; b {
-		delete(m.buckets[index].innerMap, key)
-		atomic.AddInt32(&m.count, -1)
+	bucket, t := m.lockKey(key)
+	t.metrics.addDelete()
+	if _, b := bucket.innerMap[key]; b {
+		delete(bucket.innerMap, key)
+		bucket.count--
+		bucket.cancelExpiry(key)
+		bucket.Unlock()
+		t.notifyDelete(key)
+		return
 	}
-	m.buckets[index].Unlock()
+	bucket.Unlock()
 }
 
 func (m *SafeMap[K, V]) GetAndDelete(key K) (val V, loaded bool) {
-	index := m.hashIndex(key)
-	m.buckets[index].Lock()
-	if val, b := m.buckets[index].innerMap[key]; b {
-		delete(m.buckets[index].innerMap, key)
-		atomic.AddInt32(&m.count, -1)
-		m.buckets[index].Unlock()
+	bucket, t := m.lockKey(key)
+	t.metrics.addDelete()
+	if val, b := bucket.innerMap[key]; b {
+		delete(bucket.innerMap, key)
+		bucket.count--
+		bucket.cancelExpiry(key)
+		bucket.Unlock()
+		t.notifyDelete(key)
 		return val, true
 	} else {
-		m.buckets[index].Unlock()
+		bucket.Unlock()
 		return val, false
 	}
 }
 
-// Clear clears the map
+// GetAndSet stores val under key and returns the previous value.
+// The existed result reports whether the key was present before.
+func (m *SafeMap[K, V]) GetAndSet(key K, val V) (previous V, existed bool) {
+	bucket, t := m.lockKey(key)
+	t.metrics.addSet()
+	previous, existed = bucket.innerMap[key]
+	if !existed {
+		bucket.count++
+	}
+	bucket.innerMap[key] = val
+	grow := t.overloaded(bucket)
+	bucket.Unlock()
+	t.notifySet(key)
+	if grow {
+		m.grow(t)
+	}
+	return previous, existed
+}
+
+// SetAndReport is GetAndSet under the name used by RwMap: it always stores
+// val and returns the previous value and whether the key existed.
+func (m *SafeMap[K, V]) SetAndReport(key K, val V) (previous V, existed bool) {
+	return m.GetAndSet(key, val)
+}
+
+// CompareAndSwapFunc stores new under key if the key is present and eq
+// reports its current value equal to old, and returns whether it did.
+// The comparison and the swap happen under the bucket write lock, so
+// values need not be comparable. eq must not call other methods of the map.
+func (m *SafeMap[K, V]) CompareAndSwapFunc(key K, old, new V, eq func(a, b V) bool) bool {
+	bucket, t := m.lockKey(key)
+	t.metrics.addSet()
+	if cur, b := bucket.innerMap[key]; !b || !eq(cur, old) {
+		bucket.Unlock()
+		return false
+	}
+	bucket.innerMap[key] = new
+	bucket.Unlock()
+	t.notifySet(key)
+	return true
+}
+
+// CompareAndSwap stores new under key if the key is present and its
+// current value == old, and returns whether it did.
+// For pointer values the comparison is by identity: a pointer to an equal
+// but distinct pointee does not match. Use CompareAndSwapFunc to compare
+// pointees, or values that are not comparable.
+func CompareAndSwap[K, V comparable](m *SafeMap[K, V], key K, old, new V) bool {
+	return m.CompareAndSwapFunc(key, old, new, func(a, b V) bool { return a == b })
+}
+
+// LoadAndUpdate replaces key's value with the result of fn and returns it.
+// fn receives the current value and whether the key exists, and runs under
+// the bucket write lock, so the read-modify-write is atomic. fn must not
+// call other methods of the map.
+// The loaded result reports whether the key existed before the update.
+func (m *SafeMap[K, V]) LoadAndUpdate(key K, fn func(old V, exists bool) V) (V, bool) {
+	val, b, grow, t := m.loadAndUpdate(key, fn)
+	t.notifySet(key)
+	if grow {
+		m.grow(t)
+	}
+	return val, b
+}
+
+func (m *SafeMap[K, V]) loadAndUpdate(key K, fn func(old V, exists bool) V) (V, bool, bool, *bucketTable[K, V]) {
+	bucket, t := m.lockKey(key)
+	t.metrics.addSet()
+	defer bucket.Unlock()
+	old, b := bucket.innerMap[key]
+	val := fn(old, b)
+	if !b {
+		bucket.count++
+	}
+	bucket.innerMap[key] = val
+	return val, b, t.overloaded(bucket), t
+}
+
+// Clear clears the map.
+// The buckets keep their allocated storage for reuse; use ClearAndShrink
+// to release it.
 func (m *SafeMap[K, V]) Clear() {
-	for i := 0; i < m.bucketTotal; i++ {
-		m.buckets[i].Lock()
+	m.clear(false)
+}
+
+// ClearAndShrink clears the map and replaces each bucket's storage with a
+// fresh map, so memory held by a once-large map can be reclaimed.
+func (m *SafeMap[K, V]) ClearAndShrink() {
+	m.clear(true)
+}
+
+func (m *SafeMap[K, V]) clear(shrink bool) {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	var deleted []K
+	for i := 0; i < t.bucketTotal; i++ {
+		t.buckets[i].Lock()
+		deleted = t.clearBucket(i, shrink, deleted[:0])
+	}
+}
+
+// ClearContext clears the map like Clear, one bucket at a time, but gives
+// up once ctx is done instead of blocking on a bucket held by others.
+//
+// A cancelled clear is partial: buckets cleared before ctx was done stay
+// empty, the rest keep their entries, and entries set into cleared buckets
+// meanwhile are kept. ClearContext then returns an error wrapping
+// ctx.Err() that reports how many buckets were cleared, in index order.
+// It returns nil if every bucket was cleared.
+func (m *SafeMap[K, V]) ClearContext(ctx context.Context) error {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	var deleted []K
+	for i := 0; i < t.bucketTotal; i++ {
+		if err := t.lockBucketContext(ctx, i); err != nil {
+			return fmt.Errorf("cleared %d of %d buckets: %w", i, t.bucketTotal, err)
+		}
+		deleted = t.clearBucket(i, false, deleted[:0])
+	}
+	return nil
+}
+
+// lockBucketContext write-locks bucket i, polling every clearPollInterval
+// while it is held, until ctx is done
+func (t *bucketTable[K, V]) lockBucketContext(ctx context.Context, i int) error {
+	for !t.buckets[i].TryLock() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(clearPollInterval):
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		t.buckets[i].Unlock()
+		return err
+	}
+	return nil
+}
+
+// clearBucket removes the entries of the write-locked bucket i, unlocks it
+// and notifies OnDelete observers. deleted is scratch space for the removed
+// keys, returned for reuse.
+func (t *bucketTable[K, V]) clearBucket(i int, shrink bool, deleted []K) []K {
+	bucket := t.buckets[i]
+	if t.onDelete != nil {
+		for key := range bucket.innerMap {
+			deleted = append(deleted, key)
+		}
+	}
+	if shrink {
+		bucket.innerMap = make(map[K]V)
+	} else {
 		// clear all keys
 		// avoid make new map
-		bucketLen := len(m.buckets[i].innerMap)
-		for key := range m.buckets[i].innerMap {
-			delete(m.buckets[i].innerMap, key)
+		for key := range bucket.innerMap {
+			delete(bucket.innerMap, key)
+		}
+	}
+	bucket.count = 0
+	bucket.cancelExpiries()
+	bucket.Unlock()
+	for _, key := range deleted {
+		t.notifyDelete(key)
+	}
+	return deleted
+}
+
+// Reset discards all entries and reconfigures the map in place with
+// options, as if it had been created by NewMap(options...); holders of the
+// map see the new configuration. On an error from the options, the map is
+// left unchanged. OnDelete observers are not called for the discarded
+// entries.
+//
+// Reset waits for running multi-bucket operations to finish, polling
+// rather than queueing behind them like a blocked writer would, so their
+// callbacks may keep calling into the map meanwhile. It must not be called
+// from a callback of Range, Count or any other method that spans several
+// buckets, which would wait for itself forever.
+func (m *SafeMap[K, V]) Reset(options ...OptFunc[K]) error {
+	opt, err := loadOpts(options...)
+	if err != nil {
+		return err
+	}
+	if err := checkValueCopier[K, V](opt); err != nil {
+		return err
+	}
+	fresh := newTable[K, V](opt)
+
+	// a blocked Lock would stop pinTable calls made by callbacks of the
+	// operations it waits for, deadlocking them
+	for !m.resizeMu.TryLock() {
+		time.Sleep(resetPollInterval)
+	}
+	defer m.resizeMu.Unlock()
+	t := m.table.Load()
+	t.allLock()
+	for i := 0; i < t.bucketTotal; i++ {
+		t.buckets[i].cancelExpiries()
+		t.buckets[i].stale = true
+	}
+	m.table.Store(fresh)
+	t.allUnlock()
+	return nil
+}
+
+// Grow is a hint that about n more entries are about to be added. It
+// reallocates each bucket's storage with room for its share of them, so a
+// following bulk insert doesn't rehash incrementally. Buckets are
+// processed one at a time under their write locks, and no entry is lost.
+func (m *SafeMap[K, V]) Grow(n int) {
+	if n <= 0 {
+		return
+	}
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	extra := (n + t.bucketTotal - 1) / t.bucketTotal
+	for i := 0; i < t.bucketTotal; i++ {
+		bucket := t.buckets[i]
+		bucket.Lock()
+		grown := make(map[K]V, bucket.count+extra)
+		for key, val := range bucket.innerMap {
+			grown[key] = val
 		}
-		atomic.AddInt32(&m.count, -int32(bucketLen))
-		m.buckets[i].Unlock()
+		bucket.innerMap = grown
+		bucket.Unlock()
 	}
 }
 
-// Len returns map items total
+// BucketCount returns the number of buckets the map is sharded into.
+// It changes only when a map with WithLoadFactor grows.
+func (m *SafeMap[K, V]) BucketCount() int {
+	return m.table.Load().bucketTotal
+}
+
+// Len returns map items total.
+// It sums the per-bucket counters, read-locking one bucket at a time.
 func (m *SafeMap[K, V]) Len() int {
-	return int(atomic.LoadInt32(&m.count))
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	n := 0
+	for i := 0; i < t.bucketTotal; i++ {
+		t.buckets[i].RLock()
+		n += t.buckets[i].count
+		t.buckets[i].RUnlock()
+	}
+	return n
+}
+
+// lenCache is the length cached for ApproxLen
+type lenCache struct {
+	n atomic.Int64
+	// refreshedAt is the UnixNano time of the last refresh
+	refreshedAt atomic.Int64
+	refreshing  atomic.Bool
+}
+
+// ApproxLen returns the number of entries like Len, but for a map created
+// with WithApproxLen it returns a cached count that is refreshed at most
+// every approxLenInterval (100ms), so frequent polling costs no bucket
+// locks. The result may be stale by up to that interval plus the time a
+// refresh takes. Without WithApproxLen it is the same as Len.
+func (m *SafeMap[K, V]) ApproxLen() int {
+	c := m.table.Load().lenCache
+	if c == nil {
+		return m.Len()
+	}
+	now := time.Now().UnixNano()
+	if now-c.refreshedAt.Load() >= int64(approxLenInterval) && c.refreshing.CompareAndSwap(false, true) {
+		// one caller refreshes; the others keep reading the cached count
+		c.n.Store(int64(m.Len()))
+		c.refreshedAt.Store(now)
+		c.refreshing.Store(false)
+	}
+	return int(c.n.Load())
 }
 
 // IsEmpty returns true if map is empty
 func (m *SafeMap[K, V]) IsEmpty() bool {
-	return atomic.LoadInt32(&m.count) == 0
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	for i := 0; i < t.bucketTotal; i++ {
+		t.buckets[i].RLock()
+		n := t.buckets[i].count
+		t.buckets[i].RUnlock()
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// lockedLen returns the sum of bucket counters.
+// The caller must hold the locks of all buckets.
+func (t *bucketTable[K, V]) lockedLen() int {
+	n := 0
+	for i := 0; i < t.bucketTotal; i++ {
+		n += t.buckets[i].count
+	}
+	return n
 }
 
 // GetOrSet returns the existing value for the key if present.
 // Otherwise, it stores and returns the given value.
 // The loaded result is true if the value was loaded, false if stored.
 func (m *SafeMap[K, V]) GetOrSet(key K, val V) (V, bool) {
-	index := m.hashIndex(key)
-	m.buckets[index].Lock()
-	if val, b := m.buckets[index].innerMap[key]; b {
-		m.buckets[index].Unlock()
+	bucket, t := m.lockKey(key)
+	t.metrics.addSet()
+	if val, b := bucket.innerMap[key]; b {
+		val = t.read(val)
+		bucket.Unlock()
 		return val, true
 	}
 
-	m.buckets[index].innerMap[key] = val
-	atomic.AddInt32(&m.count, 1)
-	m.buckets[index].Unlock()
+	bucket.innerMap[key] = val
+	bucket.count++
+	grow := t.overloaded(bucket)
+	bucket.Unlock()
+	t.notifySet(key)
+	if grow {
+		m.grow(t)
+	}
 	return val, false
 }
 
+// GetOrSetActual is GetOrSet with a stronger documented contract: actual is
+// always the value present in the map when the call returned, either the one
+// loaded (loaded is true) or val as stored (loaded is false). The lookup and
+// the store happen under one bucket lock, so a value another goroutine stored
+// first is returned instead of val and val is discarded.
+func (m *SafeMap[K, V]) GetOrSetActual(key K, val V) (actual V, loaded bool) {
+	return m.GetOrSet(key, val)
+}
+
 // Range calls f sequentially for each key and value present in the map.
 // If f returns false, the iteration stops.
 func (m *SafeMap[K, V]) Range(f func(k K, v V) bool) {
-	m.allLock()
-	for i := 0; i < m.bucketTotal; i++ {
-		for key, val := range m.buckets[i].innerMap {
-			if !f(key, val) {
-				m.allUnlock()
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	t.allLock()
+	for i := 0; i < t.bucketTotal; i++ {
+		for key, val := range t.buckets[i].innerMap {
+			if !f(key, t.read(val)) {
+				t.allUnlock()
+				return
+			}
+		}
+	}
+	t.allUnlock()
+}
+
+// RangeSnapshot calls f sequentially for each key and value present in the
+// map, like Range, but without holding any bucket lock while f runs.
+// If f returns false, the iteration stops.
+//
+// Each bucket's entries are copied under its read lock, which is released
+// before f is called on the copy, so writers are blocked only while a
+// bucket is copied. f sees a snapshot of each bucket, not of the whole
+// map: writes to buckets not visited yet may be seen, and writes to
+// visited ones are not. f may call other methods of the map, also while
+// another goroutine runs Reset, but not Reset itself, which waits for
+// RangeSnapshot to return.
+func (m *SafeMap[K, V]) RangeSnapshot(f func(k K, v V) bool) {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	var entries []Entry[K, V]
+	for i := 0; i < t.bucketTotal; i++ {
+		entries = entries[:0]
+		t.buckets[i].RLock()
+		for key, val := range t.buckets[i].innerMap {
+			entries = append(entries, Entry[K, V]{Key: key, Value: t.read(val)})
+		}
+		t.buckets[i].RUnlock()
+
+		for _, e := range entries {
+			if !f(e.Key, e.Value) {
+				return
+			}
+		}
+	}
+}
+
+// ValidateHashFunc checks that the map's hash function, as used to pick
+// buckets, spreads samples, a set of distinct keys, over enough buckets.
+// A hash that is constant, or varies only in bits above those used for
+// sharding, sends every key to a few buckets and silently turns the map
+// into a single-lock map. It returns an error wrapping ErrPoorHashFunc if
+// the samples occupy fewer than 1/minHashSpread of the buckets they could
+// fill, or all land in one bucket. Fewer than two samples, or a single
+// bucket, pass unchecked.
+func (m *SafeMap[K, V]) ValidateHashFunc(samples []K) error {
+	t := m.table.Load()
+	reachable := min(len(samples), t.bucketTotal)
+	if reachable < 2 {
+		return nil
+	}
+	used := make(map[int]struct{}, reachable)
+	for _, key := range samples {
+		used[t.index(key)] = struct{}{}
+	}
+	if len(used) == 1 || len(used)*minHashSpread < reachable {
+		return fmt.Errorf("%w: %d sample keys landed in %d of %d buckets", ErrPoorHashFunc, len(samples), len(used), t.bucketTotal)
+	}
+	return nil
+}
+
+// RangeBucket calls f sequentially for each key and value in bucket index
+// only, under that bucket's read lock. If f returns false, the iteration
+// stops. It is meant for inspecting skew between buckets; an index outside
+// [0, BucketCount()) returns an error wrapping ErrBucketOutOfRange.
+func (m *SafeMap[K, V]) RangeBucket(index int, f func(k K, v V) bool) error {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	if index < 0 || index >= t.bucketTotal {
+		return fmt.Errorf("%w: %d not in [0, %d)", ErrBucketOutOfRange, index, t.bucketTotal)
+	}
+	t.buckets[index].RLock()
+	defer t.buckets[index].RUnlock()
+	for key, val := range t.buckets[index].innerMap {
+		if !f(key, t.read(val)) {
+			break
+		}
+	}
+	return nil
+}
+
+// RangeWithBucket calls f sequentially for each key and value present in
+// the map, together with the index of the bucket holding it. Buckets are
+// visited in index order, each under its own read lock only, so f sees a
+// consistent view of each bucket but not of the whole map. If f returns
+// false, the iteration stops. f must not call any method of m: even a
+// read deadlocks once a writer waits for the bucket.
+func (m *SafeMap[K, V]) RangeWithBucket(f func(bucket int, k K, v V) bool) {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	for i := 0; i < t.bucketTotal; i++ {
+		if !t.rangeBucket(i, f) {
+			return
+		}
+	}
+}
+
+// rangeBucket calls f for each entry of bucket i under its read lock and
+// reports whether f returned true for all of them
+func (t *bucketTable[K, V]) rangeBucket(i int, f func(bucket int, k K, v V) bool) bool {
+	t.buckets[i].RLock()
+	defer t.buckets[i].RUnlock()
+	for key, val := range t.buckets[i].innerMap {
+		if !f(i, key, t.read(val)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Count returns the number of entries for which pred returns true.
+// Buckets are visited one at a time under their read locks, so Count
+// may run concurrently with writers; the result is not a point-in-time
+// snapshot of the whole map.
+func (m *SafeMap[K, V]) Count(pred func(k K, v V) bool) int {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	n := 0
+	for i := 0; i < t.bucketTotal; i++ {
+		t.buckets[i].RLock()
+		for key, val := range t.buckets[i].innerMap {
+			if pred(key, t.read(val)) {
+				n++
+			}
+		}
+		t.buckets[i].RUnlock()
+	}
+	return n
+}
+
+// Merge inserts all entries of other into m.
+// When a key exists in both maps, onConflict resolves the stored value
+// from the existing and incoming values; a nil onConflict means the
+// incoming value wins.
+//
+// Each bucket of other is copied under its read lock and released before
+// the entries are written into m, so Merge never holds bucket locks of
+// both maps at the same time.
+func (m *SafeMap[K, V]) Merge(other *SafeMap[K, V], onConflict func(existing, incoming V) V) {
+	t := other.pinTable()
+	defer other.unpinTable()
+
+	var keys []K
+	var vals []V
+	for i := 0; i < t.bucketTotal; i++ {
+		keys, vals = keys[:0], vals[:0]
+		t.buckets[i].RLock()
+		for key, val := range t.buckets[i].innerMap {
+			keys = append(keys, key)
+			vals = append(vals, t.read(val))
+		}
+		t.buckets[i].RUnlock()
+
+		for j := range keys {
+			m.merge(keys[j], vals[j], onConflict)
+		}
+	}
+}
+
+// merge stores val under key, resolving an existing value with onConflict
+func (m *SafeMap[K, V]) merge(key K, val V, onConflict func(existing, incoming V) V) {
+	bucket, t := m.lockKey(key)
+	t.metrics.addSet()
+	if old, b := bucket.innerMap[key]; b {
+		if onConflict != nil {
+			val = onConflict(old, val)
+		}
+	} else {
+		bucket.count++
+	}
+	bucket.innerMap[key] = val
+	grow := t.overloaded(bucket)
+	bucket.Unlock()
+	t.notifySet(key)
+	if grow {
+		m.grow(t)
+	}
+}
+
+// Equal reports whether m and other hold the same set of keys with values
+// that are equal according to eq.
+// Both maps are read-locked for the duration of the comparison.
+func (m *SafeMap[K, V]) Equal(other *SafeMap[K, V], eq func(a, b V) bool) bool {
+	if m == other {
+		return true
+	}
+
+	t, ot := lockPair(m, other)
+	defer unlockPair(m, other, t, ot)
+
+	if t.lockedLen() != ot.lockedLen() {
+		return false
+	}
+	for i := 0; i < t.bucketTotal; i++ {
+		for key, val := range t.buckets[i].innerMap {
+			otherVal, b := ot.buckets[ot.index(key)].innerMap[key]
+			if !b || !eq(val, otherVal) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// EqualComparable reports whether a and b hold the same entries,
+// comparing values with ==.
+func EqualComparable[K, V comparable](a, b *SafeMap[K, V]) bool {
+	return a.Equal(b, func(x, y V) bool { return x == y })
+}
+
+// DifferenceKeys returns the keys present in a but not in b.
+// Both maps are read-locked for the duration of the comparison, in the
+// same order as Equal, so the result is consistent for both.
+func DifferenceKeys[K comparable, V any](a, b *SafeMap[K, V]) []K {
+	if a == b {
+		return nil
+	}
+	return compareKeys(a, b, false)
+}
+
+// IntersectionKeys returns the keys present in both a and b.
+// Both maps are read-locked like in DifferenceKeys.
+func IntersectionKeys[K comparable, V any](a, b *SafeMap[K, V]) []K {
+	if a == b {
+		return a.keys()
+	}
+	return compareKeys(a, b, true)
+}
+
+// compareKeys returns the keys of a that are, or with inB false are not,
+// present in b
+func compareKeys[K comparable, V any](a, b *SafeMap[K, V], inB bool) []K {
+	ta, tb := lockPair(a, b)
+	defer unlockPair(a, b, ta, tb)
+
+	var keys []K
+	for i := 0; i < ta.bucketTotal; i++ {
+		for key := range ta.buckets[i].innerMap {
+			if _, found := tb.buckets[tb.index(key)].innerMap[key]; found == inB {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// String renders the map like Go's native map formatting, e.g. map[a:1 b:2].
+// At most maxStringEntries entries are rendered; an ellipsis marks the
+// output as truncated.
+//
+// String never blocks on a bucket: a bucket that stays write-locked is
+// skipped and reported by the ellipsis. This is always the case when
+// String is called from within a Range callback, since Range holds every
+// bucket lock.
+func (m *SafeMap[K, V]) String() string {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	snapshot := make(map[K]V)
+	truncated, full := false, false
+	for i := 0; i < t.bucketTotal && !full; i++ {
+		if !t.tryRLockBucket(i) {
+			truncated = true
+			continue
+		}
+		for key, val := range t.buckets[i].innerMap {
+			if len(snapshot) == maxStringEntries {
+				truncated, full = true, true
+				break
+			}
+			snapshot[key] = val
+		}
+		t.buckets[i].RUnlock()
+	}
+
+	str := fmt.Sprint(snapshot)
+	if truncated {
+		if len(snapshot) == 0 {
+			return "map[...]"
+		}
+		return str[:len(str)-1] + " ...]"
+	}
+	return str
+}
+
+// tryRLockBucket tries to read-lock bucket i, yielding between attempts
+func (t *bucketTable[K, V]) tryRLockBucket(i int) bool {
+	for n := 0; n < stringLockAttempts; n++ {
+		if t.buckets[i].TryRLock() {
+			return true
+		}
+		runtime.Gosched()
+	}
+	return false
+}
+
+// Incr atomically adds delta to the value stored under key and returns the
+// new value. If the key is absent, delta is stored as its value.
+func Incr[K comparable, V constraints.Integer](m *SafeMap[K, V], key K, delta V) V {
+	bucket, t := m.lockKey(key)
+	t.metrics.addSet()
+	val, b := bucket.innerMap[key]
+	if !b {
+		bucket.count++
+	}
+	val += delta
+	bucket.innerMap[key] = val
+	grow := t.overloaded(bucket)
+	bucket.Unlock()
+	t.notifySet(key)
+	if grow {
+		m.grow(t)
+	}
+	return val
+}
+
+// IncrMany atomically adds each delta to the value stored under its key,
+// storing the delta for absent keys. Keys are grouped by bucket and each
+// bucket is locked once for all of its keys, which saves lock round trips
+// over calling Incr per key when the buckets are contended; on an idle map
+// the grouping costs about as much as it saves. The increments to one
+// bucket are applied together, but other buckets may be updated before or
+// after them.
+func IncrMany[K comparable, V constraints.Integer](m *SafeMap[K, V], deltas map[K]V) {
+	m.updateGrouped(deltas, func(bucket *bucketMap[K, V], e *Entry[K, V]) {
+		val, b := bucket.innerMap[e.Key]
+		if !b {
+			bucket.count++
+		}
+		bucket.innerMap[e.Key] = val + e.Value
+	})
+}
+
+// updateGrouped calls update for each entry of src with the entry's bucket
+// write-locked, locking each bucket once for all of its entries
+func (m *SafeMap[K, V]) updateGrouped(src map[K]V, update func(bucket *bucketMap[K, V], e *Entry[K, V])) {
+	t := m.pinTable()
+
+	// order the entries by bucket with a counting sort; the entries of
+	// bucket i are entries[order[starts[i]:starts[i+1]]]
+	entries := make([]Entry[K, V], 0, len(src))
+	indexes := make([]int32, 0, len(src))
+	starts := make([]int, t.bucketTotal+1)
+	for key, val := range src {
+		i := t.index(key)
+		entries = append(entries, Entry[K, V]{Key: key, Value: val})
+		indexes = append(indexes, int32(i))
+		starts[i+1]++
+	}
+	for i := 1; i <= t.bucketTotal; i++ {
+		starts[i] += starts[i-1]
+	}
+	order := make([]int32, len(entries))
+	for j := len(indexes) - 1; j >= 0; j-- {
+		i := indexes[j] + 1
+		starts[i]--
+		order[starts[i]] = int32(j)
+	}
+	// starts[i+1] now marks the beginning of bucket i; shift it back
+	copy(starts, starts[1:])
+	starts[t.bucketTotal] = len(entries)
+
+	grow := false
+	for i := 0; i < t.bucketTotal; i++ {
+		group := order[starts[i]:starts[i+1]]
+		if len(group) == 0 {
+			continue
+		}
+		bucket := t.buckets[i]
+		bucket.Lock()
+		for _, j := range group {
+			update(bucket, &entries[j])
+		}
+		grow = grow || t.overloaded(bucket)
+		bucket.Unlock()
+		for _, j := range group {
+			t.notifySet(entries[j].Key)
+		}
+	}
+	m.unpinTable()
+
+	if grow {
+		m.grow(t)
+	}
+}
+
+// MaxBy returns the entry with the largest value according to less, and
+// false if the map is empty. Among equal values, which key is returned is
+// unspecified. Buckets are scanned one at a time under their read locks,
+// like Count.
+func MaxBy[K comparable, V any](m *SafeMap[K, V], less func(a, b V) bool) (K, V, bool) {
+	return m.extremeBy(func(cur, val V) bool { return less(cur, val) })
+}
+
+// MinBy returns the entry with the smallest value according to less, and
+// false if the map is empty. It works like MaxBy.
+func MinBy[K comparable, V any](m *SafeMap[K, V], less func(a, b V) bool) (K, V, bool) {
+	return m.extremeBy(func(cur, val V) bool { return less(val, cur) })
+}
+
+// extremeBy returns the entry that no other entry replaces, where
+// replace(cur, val) reports whether val should replace cur
+func (m *SafeMap[K, V]) extremeBy(replace func(cur, val V) bool) (key K, val V, found bool) {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	for i := 0; i < t.bucketTotal; i++ {
+		t.buckets[i].RLock()
+		for k, v := range t.buckets[i].innerMap {
+			if v = t.read(v); !found || replace(val, v) {
+				key, val, found = k, v, true
+			}
+		}
+		t.buckets[i].RUnlock()
+	}
+	return key, val, found
+}
+
+// Transform returns a new map holding every key of m with its value mapped
+// by fn. The new map shards keys like m: it has the same bucket count,
+// hash function, shard function, load factor and lock kind, so each entry
+// lands in the same bucket index without rehashing. Observers, metrics and
+// the ApproxLen cache are not carried over.
+//
+// Buckets of m are read one at a time under their read locks, with fn
+// called under the lock; fn must not call any method of m, since even a
+// read deadlocks once a writer waits for the bucket.
+func Transform[K comparable, V, W any](m *SafeMap[K, V], fn func(K, V) W) *SafeMap[K, W] {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	opt := &options[K]{
+		bucketTotal: t.bucketTotal,
+		hashFunc:    t.hashFunc,
+		shardFunc:   t.shardFunc,
+		loadFactor:  t.loadFactor,
+		spinLock:    t.spinLock,
+	}
+	res := newTable[K, W](opt)
+	for i := 0; i < t.bucketTotal; i++ {
+		t.buckets[i].RLock()
+		bucket := res.buckets[i]
+		bucket.innerMap = make(map[K]W, t.buckets[i].count)
+		for key, val := range t.buckets[i].innerMap {
+			bucket.innerMap[key] = fn(key, t.read(val))
+		}
+		bucket.count = t.buckets[i].count
+		t.buckets[i].RUnlock()
+	}
+
+	w := &SafeMap[K, W]{}
+	w.table.Store(res)
+	return w
+}
+
+// RangeContext calls f sequentially for each key and value present in the map,
+// like Range, but stops as soon as ctx is done and returns ctx.Err().
+// It returns nil if the iteration completed or f returned false.
+//
+// Buckets are visited one at a time under their read locks, and ctx is
+// checked between buckets and periodically within large buckets.
+func (m *SafeMap[K, V]) RangeContext(ctx context.Context, f func(k K, v V) bool) error {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	for i := 0; i < t.bucketTotal; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if next, err := t.rangeBucketContext(ctx, i, f); !next {
+			return err
+		}
+	}
+	return nil
+}
+
+// rangeBucketContext ranges bucket i for RangeContext, reporting whether
+// the iteration should go on with the next bucket
+func (t *bucketTable[K, V]) rangeBucketContext(ctx context.Context, i int, f func(k K, v V) bool) (bool, error) {
+	t.buckets[i].RLock()
+	defer t.buckets[i].RUnlock()
+	n := 0
+	for key, val := range t.buckets[i].innerMap {
+		if n++; n%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+		}
+		if !f(key, t.read(val)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Entry is a key-value pair sent by Stream and StreamContext
+type Entry[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// Stream returns a channel that yields every entry of the map and is closed
+// once all entries have been sent. The consumer must drain the channel;
+// use StreamContext to stop early.
+func (m *SafeMap[K, V]) Stream() <-chan Entry[K, V] {
+	return m.StreamContext(context.Background())
+}
+
+// StreamContext is like Stream, but stops sending and closes the channel
+// as soon as ctx is done.
+//
+// A goroutine copies one bucket at a time under its read lock and releases
+// it before sending the copied entries, so no lock is held while the
+// channel waits for the consumer. The stream is not a point-in-time
+// snapshot: writes made while it runs may or may not be seen, and if the
+// map grows or is Reset in the meantime the remaining buckets are read as
+// they were before.
+func (m *SafeMap[K, V]) StreamContext(ctx context.Context) <-chan Entry[K, V] {
+	ch := make(chan Entry[K, V])
+	t := m.table.Load()
+	go func() {
+		defer close(ch)
+		var entries []Entry[K, V]
+		for i := 0; i < t.bucketTotal; i++ {
+			entries = entries[:0]
+			t.buckets[i].RLock()
+			for key, val := range t.buckets[i].innerMap {
+				entries = append(entries, Entry[K, V]{Key: key, Value: t.read(val)})
+			}
+			t.buckets[i].RUnlock()
+
+			for _, e := range entries {
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// DrainStream returns a channel that yields every entry of the map while
+// removing it, and is closed once all buckets are empty. Only one bucket's
+// entries are held in memory at a time: each bucket is emptied under its
+// write lock, which is released before its entries are sent, so the
+// consumer never blocks writers. OnDelete observers are called as by Clear.
+//
+// Entries written to a bucket after it was drained stay in the map. The
+// consumer must read the channel to the end: removed entries that are not
+// received are lost, and the draining goroutine blocks until they are.
+func (m *SafeMap[K, V]) DrainStream() <-chan Entry[K, V] {
+	ch := make(chan Entry[K, V])
+	go func() {
+		defer close(ch)
+		var entries []Entry[K, V]
+		var prev *bucketTable[K, V]
+		for i := 0; ; i++ {
+			t := m.pinTable()
+			if t != prev {
+				// the table was replaced; drained buckets are empty, so
+				// starting over only revisits them
+				prev, i = t, 0
+			}
+			if i == t.bucketTotal {
+				m.unpinTable()
 				return
 			}
+			entries = entries[:0]
+			bucket := t.buckets[i]
+			bucket.Lock()
+			for key, val := range bucket.innerMap {
+				entries = append(entries, Entry[K, V]{Key: key, Value: val})
+				delete(bucket.innerMap, key)
+			}
+			bucket.count = 0
+			bucket.cancelExpiries()
+			bucket.Unlock()
+			m.unpinTable()
+
+			for _, e := range entries {
+				t.notifyDelete(e.Key)
+			}
+			for _, e := range entries {
+				ch <- e
+			}
+		}
+	}()
+	return ch
+}
+
+// Transact atomically reads and updates a group of keys.
+//
+// It locks every bucket holding one of keys, in ascending bucket order,
+// which is the order all multi-bucket operations use, so concurrent
+// transactions cannot deadlock. fn receives a view of the keys that are
+// present and returns the entries to write and the keys to delete; they
+// are applied, writes first, before any lock is released, so no reader
+// observes a partial update. fn must not call other methods of the map.
+//
+// Every written or deleted key must be one of keys; otherwise nothing is
+// applied and ErrKeyNotInTransaction is returned.
+func (m *SafeMap[K, V]) Transact(keys []K, fn func(view map[K]V) (writes map[K]V, deletes []K)) error {
+	t := m.pinTable()
+	indexes := t.indexes(keys)
+	for _, i := range indexes {
+		t.buckets[i].Lock()
+	}
+	unlock := func() {
+		for _, i := range indexes {
+			t.buckets[i].Unlock()
+		}
+		m.unpinTable()
+	}
+
+	allowed := make(map[K]struct{}, len(keys))
+	view := make(map[K]V, len(keys))
+	for _, key := range keys {
+		allowed[key] = struct{}{}
+		if val, b := t.buckets[t.index(key)].innerMap[key]; b {
+			view[key] = t.read(val)
+		}
+	}
+
+	writes, deletes := fn(view)
+	for key := range writes {
+		if _, b := allowed[key]; !b {
+			unlock()
+			return ErrKeyNotInTransaction
+		}
+	}
+	for _, key := range deletes {
+		if _, b := allowed[key]; !b {
+			unlock()
+			return ErrKeyNotInTransaction
+		}
+	}
+
+	grow := false
+	for key, val := range writes {
+		bucket := t.buckets[t.index(key)]
+		if _, b := bucket.innerMap[key]; !b {
+			bucket.count++
+		}
+		bucket.innerMap[key] = val
+		grow = grow || t.overloaded(bucket)
+	}
+	deleted := deletes[:0:0]
+	for _, key := range deletes {
+		bucket := t.buckets[t.index(key)]
+		if _, b := bucket.innerMap[key]; b {
+			delete(bucket.innerMap, key)
+			bucket.count--
+			bucket.cancelExpiry(key)
+			deleted = append(deleted, key)
+		}
+	}
+	unlock()
+
+	for key := range writes {
+		t.notifySet(key)
+	}
+	for _, key := range deleted {
+		t.notifyDelete(key)
+	}
+	if grow {
+		m.grow(t)
+	}
+	return nil
+}
+
+// Rename moves the value of oldKey to newKey, overwriting any value of
+// newKey, and deletes oldKey. It returns whether oldKey existed; if not,
+// the map is unchanged. Both buckets are write-locked, in ascending order
+// and once if they are the same, so no reader sees the value under neither
+// or both keys. Expiries set by GetOrSetWithExpiry for either key are
+// dropped, so the moved value does not expire.
+func (m *SafeMap[K, V]) Rename(oldKey, newKey K) bool {
+	t := m.pinTable()
+	indexes := t.indexes([]K{oldKey, newKey})
+	for _, i := range indexes {
+		t.buckets[i].Lock()
+	}
+	unlock := func() {
+		for _, i := range indexes {
+			t.buckets[i].Unlock()
+		}
+		m.unpinTable()
+	}
+
+	from := t.buckets[t.index(oldKey)]
+	val, b := from.innerMap[oldKey]
+	if !b || oldKey == newKey {
+		unlock()
+		return b
+	}
+	delete(from.innerMap, oldKey)
+	from.count--
+	from.cancelExpiry(oldKey)
+	to := t.buckets[t.index(newKey)]
+	if _, b := to.innerMap[newKey]; !b {
+		to.count++
+	}
+	to.innerMap[newKey] = val
+	to.cancelExpiry(newKey)
+	grow := t.overloaded(to)
+	unlock()
+
+	t.notifyDelete(oldKey)
+	t.notifySet(newKey)
+	if grow {
+		m.grow(t)
+	}
+	return true
+}
+
+// RangeSorted calls f for each key and value present in the map, in the key
+// order defined by less. If f returns false, the iteration stops.
+//
+// The keys are snapshotted under per-bucket read locks and sorted, then
+// each value is re-read right before f is called; keys deleted in the
+// meantime are skipped. No lock is held while f runs.
+func (m *SafeMap[K, V]) RangeSorted(less func(a, b K) bool, f func(k K, v V) bool) {
+	keys := m.keys()
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	for _, key := range keys {
+		val, b := m.Get(key)
+		if !b {
+			continue
+		}
+		if !f(key, val) {
+			return
+		}
+	}
+}
+
+// keys returns the map's keys, read-locking one bucket at a time
+func (m *SafeMap[K, V]) keys() []K {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	var keys []K
+	for i := 0; i < t.bucketTotal; i++ {
+		t.buckets[i].RLock()
+		for key := range t.buckets[i].innerMap {
+			keys = append(keys, key)
+		}
+		t.buckets[i].RUnlock()
+	}
+	return keys
+}
+
+// ToMap returns a copy of the map's entries as a native map.
+// Buckets are copied one at a time under their read locks.
+func (m *SafeMap[K, V]) ToMap() map[K]V {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	res := make(map[K]V)
+	for i := 0; i < t.bucketTotal; i++ {
+		t.buckets[i].RLock()
+		for key, val := range t.buckets[i].innerMap {
+			res[key] = t.read(val)
+		}
+		t.buckets[i].RUnlock()
+	}
+	return res
+}
+
+// DeleteIf deletes every entry for which pred returns true and returns the
+// number of entries removed. Buckets are processed one at a time under
+// their write locks, so writers to other buckets are not blocked.
+// pred must not call other methods of the map.
+func (m *SafeMap[K, V]) DeleteIf(pred func(k K, v V) bool) int {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	n := 0
+	var deleted []K
+	for i := 0; i < t.bucketTotal; i++ {
+		deleted = deleted[:0]
+		t.buckets[i].Lock()
+		for key, val := range t.buckets[i].innerMap {
+			if pred(key, val) {
+				delete(t.buckets[i].innerMap, key)
+				t.buckets[i].cancelExpiry(key)
+				deleted = append(deleted, key)
+			}
+		}
+		t.buckets[i].count -= len(deleted)
+		t.buckets[i].Unlock()
+		n += len(deleted)
+		for _, key := range deleted {
+			t.notifyDelete(key)
+		}
+	}
+	return n
+}
+
+// Action tells RangeUpdate what to do with an entry
+type Action int
+
+const (
+	// ActionKeep leaves the entry unchanged
+	ActionKeep Action = iota
+	// ActionUpdate stores the returned value for the entry
+	ActionUpdate
+	// ActionDelete deletes the entry
+	ActionDelete
+)
+
+// RangeUpdate calls f for each entry and applies the Action it returns:
+// keep the entry, replace its value with the returned one, or delete it.
+// Buckets are processed one at a time under their write locks, like
+// DeleteIf, so each entry is changed atomically with the read f saw.
+// f must not call other methods of the map.
+func (m *SafeMap[K, V]) RangeUpdate(f func(k K, v V) (newVal V, action Action)) {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	var updated, deleted []K
+	for i := 0; i < t.bucketTotal; i++ {
+		updated, deleted = updated[:0], deleted[:0]
+		bucket := t.buckets[i]
+		bucket.Lock()
+		for key, val := range bucket.innerMap {
+			switch newVal, action := f(key, val); action {
+			case ActionUpdate:
+				bucket.innerMap[key] = newVal
+				updated = append(updated, key)
+			case ActionDelete:
+				delete(bucket.innerMap, key)
+				bucket.cancelExpiry(key)
+				deleted = append(deleted, key)
+			}
+		}
+		bucket.count -= len(deleted)
+		bucket.Unlock()
+		for _, key := range updated {
+			t.notifySet(key)
+		}
+		for _, key := range deleted {
+			t.notifyDelete(key)
+		}
+	}
+}
+
+// TakeIf deletes up to limit entries for which pred returns true and
+// returns them; a limit <= 0 takes all of them. Each entry is tested and
+// deleted under its bucket's write lock, so concurrent callers never take
+// the same entry. Buckets are processed one at a time, like DeleteIf.
+// pred must not call other methods of the map.
+func (m *SafeMap[K, V]) TakeIf(pred func(k K, v V) bool, limit int) map[K]V {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	taken := make(map[K]V)
+	var deleted []K
+	for i := 0; i < t.bucketTotal && (limit <= 0 || len(taken) < limit); i++ {
+		deleted = deleted[:0]
+		t.buckets[i].Lock()
+		for key, val := range t.buckets[i].innerMap {
+			if limit > 0 && len(taken) == limit {
+				break
+			}
+			if pred(key, val) {
+				delete(t.buckets[i].innerMap, key)
+				t.buckets[i].cancelExpiry(key)
+				taken[key] = val
+				deleted = append(deleted, key)
+			}
+		}
+		t.buckets[i].count -= len(deleted)
+		t.buckets[i].Unlock()
+		for _, key := range deleted {
+			t.notifyDelete(key)
 		}
 	}
-	m.allUnlock()
+	return taken
+}
+
+// EstimateMemory returns a rough estimate, in bytes, of the memory held by
+// the map: the entry count times the size of a key and a value, plus a
+// fixed overhead per bucket. It does not account for the runtime's map
+// internals or for memory referenced by keys and values (string bytes,
+// slice backing arrays, pointees), so treat it as a lower bound suited to
+// capacity planning.
+func (m *SafeMap[K, V]) EstimateMemory() int64 {
+	var key K
+	var val V
+	entrySize := int64(unsafe.Sizeof(key) + unsafe.Sizeof(val))
+	bucketSize := int64(unsafe.Sizeof(bucketMap[K, V]{})) + mapHeaderSize + int64(unsafe.Sizeof(&bucketMap[K, V]{}))
+	return int64(m.Len())*entrySize + int64(m.BucketCount())*bucketSize
 }
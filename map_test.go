@@ -1,13 +1,49 @@
 package safemap
 
 import (
+	"context"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"reflect"
+	"runtime"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// verifyCount locks every bucket and compares the entries actually held
+// with the per-bucket count bookkeeping. want is the number of entries,
+// got the sum of the counts; ok reports whether every bucket agrees.
+func (m *SafeMap[K, V]) verifyCount() (want, got int, ok bool) {
+	t := m.pinTable()
+	defer m.unpinTable()
+
+	t.allRLock()
+	defer t.allRUnlock()
+	ok = true
+	for i := 0; i < t.bucketTotal; i++ {
+		want += len(t.buckets[i].innerMap)
+		got += t.buckets[i].count
+		ok = ok && len(t.buckets[i].innerMap) == t.buckets[i].count
+	}
+	return want, got, ok
+}
+
+// assertCount fails the test if m's counts have drifted from its entries
+func assertCount[K comparable, V any](t *testing.T, m *SafeMap[K, V]) {
+	t.Helper()
+	want, got, ok := m.verifyCount()
+	assert.True(t, ok, "count drifted: %d entries, counts sum to %d", want, got)
+}
+
 func TestNewSafeMap(t *testing.T) {
 	_, err := NewMap[string, string]()
 	assert.ErrorIs(t, err, ErrMissingHashFunc)
@@ -27,6 +63,305 @@ func TestNewInteger(t *testing.T) {
 	assert.NotNil(t, m)
 }
 
+func TestNewFloatMap(t *testing.T) {
+	m := NewFloatMap[float64, string]()
+	for i := 0; i < 1000; i++ {
+		m.Set(float64(i)/4, strconv.Itoa(i))
+	}
+	assert.Equal(t, 1000, m.Len())
+	val, ok := m.Get(2.25)
+	assert.True(t, ok)
+	assert.Equal(t, "9", val)
+	val, ok = m.Get(-1.5)
+	assert.False(t, ok)
+	assert.Equal(t, "", val)
+
+	// -0 and +0 are the same key
+	m.Set(math.Copysign(0, -1), "negative zero")
+	assert.Equal(t, 1000, m.Len())
+	val, _ = m.Get(0)
+	assert.Equal(t, "negative zero", val)
+
+	// NaN keys can be stored but never retrieved
+	m.Set(math.NaN(), "nan")
+	m.Set(math.NaN(), "nan")
+	assert.Equal(t, 1002, m.Len())
+	_, ok = m.Get(math.NaN())
+	assert.False(t, ok)
+
+	f32 := NewFloatMap[float32, int]()
+	f32.Set(1.5, 1)
+	val32, ok := f32.Get(1.5)
+	assert.True(t, ok)
+	assert.Equal(t, 1, val32)
+}
+
+func TestNewMapOf(t *testing.T) {
+	s := NewMapOf[string, int]()
+	s.Set("a", 1)
+	val, ok := s.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, val)
+
+	n := NewMapOf[int, string]()
+	for i := -50; i < 50; i++ {
+		n.Set(i, strconv.Itoa(i))
+	}
+	assert.Equal(t, 100, n.Len())
+	str, _ := n.Get(-7)
+	assert.Equal(t, "-7", str)
+
+	type ID struct {
+		A     uint64
+		Label string
+	}
+	st := NewMapOf[ID, int]()
+	st.Set(ID{A: 1, Label: "x"}, 1)
+	st.Set(ID{A: 1, Label: "x"}, 2)
+	st.Set(ID{A: 2, Label: "x"}, 3)
+	assert.Equal(t, 2, st.Len())
+	val, _ = st.Get(ID{A: 1, Label: "x"})
+	assert.Equal(t, 2, val)
+
+	// WithHashFunc overrides the default
+	o := NewMapOf[int, int](WithHashFunc(func(int) uint64 { return 3 }), WithBuckets[int](2))
+	o.Set(1, 1)
+	o.Set(2, 2)
+	assert.Equal(t, 3, o.hashIndex(1))
+	assert.Equal(t, 3, o.hashIndex(2))
+}
+
+func TestNewStructMap(t *testing.T) {
+	type inner struct {
+		Name string
+		tags [2]string
+	}
+	type ID struct {
+		A, B  uint64
+		Label string
+		In    inner
+		Any   any
+	}
+
+	m := NewStructMap[ID, int]()
+	for i := 0; i < 100; i++ {
+		m.Set(ID{A: uint64(i), B: 1, Label: "x"}, i)
+		m.Set(ID{A: uint64(i), B: 2, Label: "x"}, -i)
+	}
+	assert.Equal(t, 200, m.Len())
+
+	// equal structs are the same entry
+	key := ID{A: 7, B: 2, Label: "x"}
+	val, ok := m.Get(key)
+	assert.True(t, ok)
+	assert.Equal(t, -7, val)
+	m.Set(ID{A: 7, B: 2, Label: "x"}, 70)
+	assert.Equal(t, 200, m.Len())
+	val, _ = m.Get(key)
+	assert.Equal(t, 70, val)
+
+	// string, nested and interface fields distinguish keys
+	k1 := ID{Label: "ab", In: inner{Name: "c", tags: [2]string{"t", ""}}, Any: 1}
+	k2 := ID{Label: "a", In: inner{Name: "bc", tags: [2]string{"t", ""}}, Any: 1}
+	k3 := ID{Label: "ab", In: inner{Name: "c", tags: [2]string{"t", ""}}, Any: "1"}
+	m.Set(k1, 1)
+	m.Set(k2, 2)
+	m.Set(k3, 3)
+	assert.Equal(t, 203, m.Len())
+	hash := HashStruct[ID]()
+	assert.Equal(t, hash(k1), hash(ID{Label: "ab", In: inner{Name: "c", tags: [2]string{"t", ""}}, Any: 1}))
+	assert.NotEqual(t, hash(k1), hash(k2))
+	for want, k := range []ID{k1, k2, k3} {
+		val, ok := m.Get(k)
+		assert.True(t, ok)
+		assert.Equal(t, want+1, val)
+	}
+}
+
+func TestBucketCount(t *testing.T) {
+	m := NewStringMap[string, int](WithBuckets[string](6))
+	assert.Equal(t, 64, m.BucketCount())
+	assert.Equal(t, defaultBucketCount, NewStringMap[string, int]().BucketCount())
+	assert.Equal(t, maxBucketCount, NewStringMap[string, int](WithBuckets[string](20)).BucketCount())
+
+	// sibling maps can reuse the bucket count
+	sibling := NewStringMap[string, int](WithBuckets[string](uint8(bits.TrailingZeros(uint(m.BucketCount())))))
+	assert.Equal(t, m.BucketCount(), sibling.BucketCount())
+}
+
+func TestFromMap(t *testing.T) {
+	src := map[string]int{"a": 1, "b": 2, "c": 3}
+
+	_, err := FromMap(src)
+	assert.ErrorIs(t, err, ErrMissingHashFunc)
+
+	m, err := FromMap(src, HashStrKeyFunc())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, m.Len())
+	assert.Equal(t, src, m.ToMap())
+
+	strMap := FromStringMap(src)
+	assert.Equal(t, 3, strMap.Len())
+	assert.Equal(t, src, strMap.ToMap())
+
+	intSrc := map[int]string{-1: "a", 0: "b", 1: "c"}
+	intMap := FromIntegerMap(intSrc)
+	assert.Equal(t, 3, intMap.Len())
+	assert.Equal(t, intSrc, intMap.ToMap())
+
+	// the result is a copy
+	res := m.ToMap()
+	res["d"] = 4
+	assert.False(t, m.Contains("d"))
+	assert.Empty(t, NewStringMap[string, int]().ToMap())
+}
+
+func TestWithBucketsE(t *testing.T) {
+	for mask := uint8(0); mask <= maxBucketMask; mask++ {
+		m, err := NewMap[string, int](HashStrKeyFunc(), WithBucketsE[string](mask))
+		assert.Nil(t, err)
+		assert.Equal(t, 1<<mask, m.BucketCount())
+	}
+
+	for _, mask := range []uint8{maxBucketMask + 1, 32, 64, 255} {
+		m, err := NewMap[string, int](HashStrKeyFunc(), WithBucketsE[string](mask))
+		assert.ErrorIs(t, err, ErrInvalidBuckets, mask)
+		assert.Contains(t, err.Error(), strconv.Itoa(int(mask)))
+		assert.Nil(t, m)
+	}
+
+	// the lenient option still clamps
+	m, err := NewMap[string, int](HashStrKeyFunc(), WithBuckets[string](maxBucketMask+1))
+	assert.Nil(t, err)
+	assert.Equal(t, maxBucketCount, m.BucketCount())
+
+	// constructors without an error result panic with the wrapped error
+	assertPanicsWith := func(target error, f func()) {
+		defer func() {
+			err, _ := recover().(error)
+			assert.ErrorIs(t, err, target)
+		}()
+		f()
+	}
+	assertPanicsWith(ErrInvalidBuckets, func() { NewStringMap[string, int](WithBucketsE[string](maxBucketMask + 1)) })
+	assertPanicsWith(ErrInvalidBuckets, func() { NewIntegerMap[int, int](WithBucketsE[int](maxBucketMask + 1)) })
+	assertPanicsWith(ErrInvalidBuckets, func() { NewFloatMap[float64, int](WithBucketsE[float64](maxBucketMask + 1)) })
+	assertPanicsWith(ErrInvalidBuckets, func() { NewStructMap[string, int](WithBucketsE[string](maxBucketMask + 1)) })
+	assertPanicsWith(ErrInvalidBuckets, func() { NewMapOf[string, int](WithBucketsE[string](maxBucketMask + 1)) })
+	copier := func(s string) string { return s }
+	assertPanicsWith(ErrValueCopierType, func() { NewStringMap[string, int](WithValueCopier[string](copier)) })
+}
+
+func TestAutoBuckets(t *testing.T) {
+	assert.Equal(t, uint8(bits.Len(defaultBucketCount-1)), AutoBuckets[string](nil, Hashstr))
+
+	// uniformly hashed keys support many buckets, more with a larger sample
+	small := make([]string, 1000)
+	large := make([]string, 100000)
+	for i := range large {
+		large[i] = strconv.Itoa(i)
+	}
+	copy(small, large)
+	smallMask, largeMask := AutoBuckets(small, Hashstr), AutoBuckets(large, Hashstr)
+	assert.GreaterOrEqual(t, smallMask, uint8(3))
+	assert.Greater(t, largeMask, smallMask)
+	assert.LessOrEqual(t, largeMask, uint8(maxBucketMask))
+
+	// the recommendation keeps the skew bounded
+	m := NewStringMap[string, int](WithBuckets[string](largeMask))
+	for _, key := range large {
+		m.Set(key, 0)
+	}
+	largest := 0
+	for _, bucket := range m.table.Load().buckets {
+		largest = max(largest, bucket.count)
+	}
+	assert.LessOrEqual(t, float64(largest), maxAutoBucketSkew*float64(len(large))/float64(m.BucketCount()))
+
+	// identity hashes of multiples of 1024 all share their low bits
+	clustered := make([]int, 1000)
+	for i := range clustered {
+		clustered[i] = i * 1024
+	}
+	assert.Equal(t, uint8(0), AutoBuckets(clustered, func(k int) uint64 { return uint64(k) }))
+}
+
+func TestWithConcurrencyLevel(t *testing.T) {
+	for procs, want := range map[int]int{
+		1:    4,
+		2:    8,
+		3:    16,
+		8:    32,
+		100:  512,
+		256:  maxBucketCount,
+		5000: maxBucketCount,
+	} {
+		m := NewStringMap[string, int](WithConcurrencyLevel[string](procs))
+		assert.Equal(t, want, m.BucketCount(), procs)
+	}
+
+	m := NewStringMap[string, int](WithConcurrencyLevel[string](0))
+	want := NewStringMap[string, int](WithConcurrencyLevel[string](runtime.GOMAXPROCS(0)))
+	assert.Equal(t, want.BucketCount(), m.BucketCount())
+}
+
+func TestWithConcurrencyLevelShared(t *testing.T) {
+	// one option applied by several constructors at once must not race
+	option := WithConcurrencyLevel[string](0)
+	want := NewStringMap[string, int](WithConcurrencyLevel[string](runtime.GOMAXPROCS(0))).BucketCount()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m := NewStringMap[string, int](option)
+			assert.Equal(t, want, m.BucketCount())
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWithShardFunc(t *testing.T) {
+	// fibonacci hashing takes the high bits of the product, so keys that
+	// share their low bits still spread over all buckets
+	fibonacci := func(hash uint64, bucketTotal int) int {
+		return int((hash * 11400714819323198485) >> (64 - bits.Len(uint(bucketTotal-1))))
+	}
+	largest := func(m *SafeMap[int, int]) int {
+		n := 0
+		for _, bucket := range m.table.Load().buckets {
+			n = max(n, bucket.count)
+		}
+		return n
+	}
+
+	masked := NewIntegerMap[int, int]()
+	sharded := NewIntegerMap[int, int](WithShardFunc[int](fibonacci))
+	for i := 0; i < 3200; i++ {
+		// keys are multiples of the bucket count
+		masked.Set(i*defaultBucketCount, i)
+		sharded.Set(i*defaultBucketCount, i)
+	}
+	assert.Equal(t, 3200, largest(masked))
+	assert.Less(t, largest(sharded), 2*3200/defaultBucketCount)
+
+	for i := 0; i < 3200; i++ {
+		val, ok := sharded.Get(i * defaultBucketCount)
+		assert.True(t, ok)
+		assert.Equal(t, i, val)
+	}
+
+	// the shard func keeps applying after growth
+	g := NewIntegerMap[int, int](WithShardFunc[int](fibonacci), WithBuckets[int](0), WithLoadFactor[int](8))
+	for i := 0; i < 1000; i++ {
+		g.Set(i*maxBucketCount, i)
+	}
+	assert.Greater(t, g.BucketCount(), 1)
+	assert.Equal(t, 1000, g.Len())
+	val, _ := g.Get(999 * maxBucketCount)
+	assert.Equal(t, 999, val)
+}
+
 func TestInteger(t *testing.T) {
 	m := NewIntegerMap[int, int]()
 	m.Set(-1, 1)
@@ -48,6 +383,7 @@ func TestSafeMapLen(t *testing.T) {
 		}(i)
 	}
 	wg.Wait()
+	assertCount(t, safeMap)
 
 	assert.Equal(t, 10050, safeMap.Len())
 
@@ -60,10 +396,87 @@ func TestSafeMapLen(t *testing.T) {
 		}()
 	}
 	wg.Wait()
+	assertCount(t, safeMap)
 
 	assert.Equal(t, 0, safeMap.Len())
 }
 
+func TestCountInvariant(t *testing.T) {
+	m := NewIntegerMap[int, int](WithBuckets[int](1), WithLoadFactor[int](4))
+
+	const workers, loops, keys = 8, 2000, 64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			r := rand.New(rand.NewPCG(uint64(w), 0))
+			for i := 0; i < loops; i++ {
+				k := r.IntN(keys)
+				switch r.IntN(12) {
+				case 0:
+					m.Set(k, i)
+				case 1:
+					m.Delete(k)
+				case 2:
+					m.GetAndDelete(k)
+				case 3:
+					m.GetOrSet(k, i)
+				case 4:
+					m.LoadAndUpdate(k, func(old int, exists bool) int { return old + 1 })
+				case 5:
+					m.GetAndSet(k, i)
+				case 6:
+					m.SetAll(map[int]int{k: i, k + 1: i, k + keys: i})
+				case 7:
+					m.Rename(k, (k+1)%keys)
+				case 8:
+					m.DeleteIf(func(k, v int) bool { return v%5 == 0 })
+				case 9:
+					m.TakeIf(func(k, v int) bool { return k%3 == 0 }, 2)
+				case 10:
+					m.RangeUpdate(func(k, v int) (int, Action) {
+						if v%2 == 0 {
+							return 0, ActionDelete
+						}
+						return v + 1, ActionUpdate
+					})
+				case 11:
+					if r.IntN(10) == 0 {
+						m.Clear()
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	assertCount(t, m)
+	want, _, _ := m.verifyCount()
+	assert.Equal(t, want, m.Len())
+	assert.Greater(t, m.BucketCount(), 2)
+}
+
+func TestSetAll(t *testing.T) {
+	m := NewStringMap[string, int](WithBuckets[string](2))
+	m.Set("a", -1)
+	m.Set("keep", 0)
+	src := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		src[strconv.Itoa(i)] = i
+	}
+	src["a"] = 1
+
+	m.SetAll(src)
+	m.SetAll(nil)
+	assert.Equal(t, 102, m.Len())
+	want := map[string]int{"keep": 0}
+	for key, val := range src {
+		want[key] = val
+	}
+	assert.Equal(t, want, m.ToMap())
+}
+
 func TestGetAndDelete(t *testing.T) {
 	const N = 50000
 	m, _ := NewMap[string, string](HashStrKeyFunc())
@@ -92,6 +505,39 @@ func TestGetAndDelete(t *testing.T) {
 	}
 	wg.Wait()
 	close(ch)
+	assertCount(t, m)
+}
+
+func TestSetAndReport(t *testing.T) {
+	m := NewStringMap[string, int]()
+
+	prev, existed := m.SetAndReport("a", 1)
+	assert.False(t, existed)
+	assert.Equal(t, 0, prev)
+
+	prev, existed = m.SetAndReport("a", 2)
+	assert.True(t, existed)
+	assert.Equal(t, 1, prev)
+
+	val, _ := m.Get("a")
+	assert.Equal(t, 2, val)
+	assert.Equal(t, 1, m.Len())
+}
+
+func TestGetAndSet(t *testing.T) {
+	m := NewStringMap[string, int]()
+
+	prev, existed := m.GetAndSet("a", 1)
+	assert.False(t, existed)
+	assert.Equal(t, 0, prev)
+	assert.Equal(t, 1, m.Len())
+
+	prev, existed = m.GetAndSet("a", 2)
+	assert.True(t, existed)
+	assert.Equal(t, 1, prev)
+	assert.Equal(t, 1, m.Len())
+	val, _ := m.Get("a")
+	assert.Equal(t, 2, val)
 }
 
 func TestGetOrSet(t *testing.T) {
@@ -118,6 +564,207 @@ func TestGetOrSet(t *testing.T) {
 		}(i)
 	}
 	wg.Wait()
+	assertCount(t, m)
+}
+
+func TestGetOrSetActual(t *testing.T) {
+	m := NewStringMap[string, int]()
+
+	// every goroutine offers its own value; exactly one is stored and all
+	// of them must see that one rather than the value they passed in
+	const N = 100
+	actuals := make([]int, N)
+	stored := make([]bool, N)
+	var wg sync.WaitGroup
+	for i := 0; i < N; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			actual, loaded := m.GetOrSetActual("k", n)
+			actuals[n] = actual
+			stored[n] = !loaded
+		}(i)
+	}
+	wg.Wait()
+
+	winner, _ := m.Get("k")
+	var stores int
+	for i := 0; i < N; i++ {
+		assert.Equal(t, winner, actuals[i])
+		if stored[i] {
+			stores++
+			assert.Equal(t, i, winner)
+		}
+	}
+	assert.Equal(t, 1, stores)
+	assert.Equal(t, 1, m.Len())
+}
+
+func TestGetWithLock(t *testing.T) {
+	m := NewStringMap[string, int](WithBuckets[string](0))
+	m.Set("a", 1)
+
+	val, ok, unlock := m.GetWithLock("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, val)
+
+	// readers share the lock, writers wait for unlock
+	_, found, acquired := m.TryGet("a")
+	assert.True(t, acquired)
+	assert.True(t, found)
+	set := make(chan struct{})
+	go func() {
+		m.Set("a", 2)
+		close(set)
+	}()
+	select {
+	case <-set:
+		t.Fatal("Set finished while the bucket was locked")
+	case <-time.After(20 * time.Millisecond):
+	}
+	// a forgotten unlock shows as a bucket that cannot be write-locked
+	assert.False(t, m.table.Load().buckets[0].TryLock())
+
+	unlock()
+	unlock()
+	<-set
+	val, _ = m.Get("a")
+	assert.Equal(t, 2, val)
+
+	_, ok, unlock = m.GetWithLock("missing")
+	assert.False(t, ok)
+	unlock()
+	assert.True(t, m.table.Load().buckets[0].TryLock())
+	m.table.Load().buckets[0].Unlock()
+}
+
+func TestTryGet(t *testing.T) {
+	m := NewStringMap[string, int]()
+	m.Set("a", 1)
+
+	val, found, acquired := m.TryGet("a")
+	assert.True(t, acquired)
+	assert.True(t, found)
+	assert.Equal(t, 1, val)
+	_, found, acquired = m.TryGet("b")
+	assert.True(t, acquired)
+	assert.False(t, found)
+
+	// a write-locked bucket is reported as contended without blocking
+	bucket := m.table.Load().buckets[m.hashIndex("a")]
+	bucket.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		val, found, acquired := m.TryGet("a")
+		assert.False(t, acquired)
+		assert.False(t, found)
+		assert.Zero(t, val)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("TryGet blocked on a locked bucket")
+	}
+	bucket.Unlock()
+
+	// read locks don't block it
+	bucket.RLock()
+	_, _, acquired = m.TryGet("a")
+	assert.True(t, acquired)
+	bucket.RUnlock()
+}
+
+func TestGetMultiple(t *testing.T) {
+	m := NewIntegerMap[int, int]()
+	for i := 0; i < 10; i++ {
+		m.Set(i, i)
+	}
+	assert.Equal(t, map[int]int{1: 1, 5: 5}, m.GetMultiple([]int{1, 5, 20, 5}))
+	assert.Empty(t, m.GetMultiple(nil))
+
+	// a writer moves value between keys in different buckets, keeping the
+	// sum fixed; every multi-key read must see that sum
+	keys := []int{0, 1, 2, 3}
+	for _, key := range keys {
+		m.Set(key, 100)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			from, to := keys[i%4], keys[(i+1)%4]
+			err := m.Transact([]int{from, to}, func(view map[int]int) (map[int]int, []int) {
+				return map[int]int{from: view[from] - 1, to: view[to] + 1}, nil
+			})
+			assert.Nil(t, err)
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		sum := 0
+		for _, val := range m.GetMultiple(keys) {
+			sum += val
+		}
+		assert.Equal(t, 400, sum)
+	}
+}
+
+func TestGetOrDefault(t *testing.T) {
+	m := NewStringMap[string, int]()
+	m.Set("key", 42)
+	m.Set("zero", 0)
+
+	assert.Equal(t, 42, m.GetOrDefault("key", -1))
+	assert.Equal(t, -1, m.GetOrDefault("missing", -1))
+	assert.Equal(t, 0, m.GetOrDefault("zero", -1))
+	assert.Equal(t, 2, m.Len())
+	assert.False(t, m.Contains("missing"))
+}
+
+func TestContains(t *testing.T) {
+	m := NewStringMap[string, [1024]byte]()
+	assert.False(t, m.Contains("key"))
+
+	m.Set("key", [1024]byte{})
+	assert.True(t, m.Contains("key"))
+	assert.False(t, m.Contains("other"))
+
+	m.Delete("key")
+	assert.False(t, m.Contains("key"))
+}
+
+func TestApproxLen(t *testing.T) {
+	m := NewIntegerMap[int, int](WithApproxLen[int]())
+	assert.Equal(t, 0, m.ApproxLen())
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	// writes have settled; the cache catches up once it expires
+	time.Sleep(approxLenInterval)
+	assert.Equal(t, 1000, m.ApproxLen())
+	m.Delete(0)
+	time.Sleep(approxLenInterval)
+	assert.Equal(t, m.Len(), m.ApproxLen())
+
+	// without the option it is exact
+	e := NewIntegerMap[int, int]()
+	e.Set(1, 1)
+	assert.Equal(t, 1, e.ApproxLen())
+}
+
+func TestTouch(t *testing.T) {
+	m := NewStringMap[string, int]()
+	m.Set("a", 1)
+	assert.True(t, m.Touch("a"))
+	assert.False(t, m.Touch("b"))
+	assert.False(t, m.Contains("b"))
+	val, _ := m.Get("a")
+	assert.Equal(t, 1, val)
 }
 
 func TestIsEmpty(t *testing.T) {
@@ -167,6 +814,33 @@ func TestRange(t *testing.T) {
 	assert.Equal(t, 2, count)
 }
 
+func TestRangeSnapshot(t *testing.T) {
+	m := NewIntegerMap[int, int](WithBuckets[int](2))
+	want := make(map[int]int)
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+		want[i] = i
+	}
+
+	got := make(map[int]int)
+	m.RangeSnapshot(func(k, v int) bool {
+		got[k] = v
+		// no lock is held while f runs
+		m.Set(k, -v)
+		return true
+	})
+	assert.Equal(t, want, got)
+	val, _ := m.Get(7)
+	assert.Equal(t, -7, val)
+
+	n := 0
+	m.RangeSnapshot(func(k, v int) bool {
+		n++
+		return n < 3
+	})
+	assert.Equal(t, 3, n)
+}
+
 func TestConcurrentOperations(t *testing.T) {
 	m, _ := NewMap[string, int](WithHashFunc(func(s string) uint64 { return Hashstr(s) }))
 
@@ -184,6 +858,7 @@ func TestConcurrentOperations(t *testing.T) {
 		}(i)
 	}
 	wg.Wait()
+	assertCount(t, m)
 
 	// Verify final map state
 	assert.True(t, m.Len() == 1000)
@@ -198,13 +873,1504 @@ func TestClear(t *testing.T) {
 	assert.Equal(t, 0, m.Len())
 }
 
-func BenchmarkSafeMapClear(b *testing.B) {
-	m, _ := NewMap[string, int](WithHashFunc(func(s string) uint64 { return Hashstr(s) }))
+func TestRangeWithBucket(t *testing.T) {
+	m := NewIntegerMap[int, int](WithBuckets[int](3))
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+
+	seen := make(map[int]int)
+	last := -1
+	m.RangeWithBucket(func(bucket int, k, v int) bool {
+		assert.Equal(t, m.hashIndex(k), bucket)
+		assert.GreaterOrEqual(t, bucket, last)
+		last = bucket
+		seen[k] = v
+		return true
+	})
+	assert.Equal(t, m.ToMap(), seen)
+
+	var n int
+	m.RangeWithBucket(func(bucket int, k, v int) bool {
+		n++
+		return false
+	})
+	assert.Equal(t, 1, n)
+}
+
+func TestValidateHashFunc(t *testing.T) {
+	samples := make([]int, 100)
+	for i := range samples {
+		samples[i] = i
+	}
+
+	good := NewIntegerMap[int, int](WithBuckets[int](4))
+	assert.Nil(t, good.ValidateHashFunc(samples))
+
+	constant, _ := NewMap[int, int](WithHashFunc(func(int) uint64 { return 7 }), WithBuckets[int](4))
+	assert.ErrorIs(t, constant.ValidateHashFunc(samples), ErrPoorHashFunc)
+
+	// the hash varies only above the bits used for sharding
+	highBits, _ := NewMap[int, int](WithHashFunc(func(k int) uint64 { return uint64(k) << 32 }), WithBuckets[int](4))
+	assert.ErrorIs(t, highBits.ValidateHashFunc(samples), ErrPoorHashFunc)
+
+	// two keys in one bucket are enough to flag a constant hash
+	assert.ErrorIs(t, constant.ValidateHashFunc(samples[:2]), ErrPoorHashFunc)
+	assert.Nil(t, good.ValidateHashFunc(samples[:2]))
+
+	// too little to judge
+	assert.Nil(t, constant.ValidateHashFunc(samples[:1]))
+	single, _ := NewMap[int, int](WithHashFunc(func(int) uint64 { return 7 }), WithBuckets[int](0))
+	assert.Nil(t, single.ValidateHashFunc(samples))
+}
+
+func TestRangeBucket(t *testing.T) {
+	m := NewStringMap[string, int](WithBuckets[string](3))
+	for i := 0; i < 200; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+
+	total := 0
+	for index := 0; index < m.BucketCount(); index++ {
+		err := m.RangeBucket(index, func(k string, v int) bool {
+			assert.Equal(t, index, m.hashIndex(k))
+			total++
+			return true
+		})
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 200, total)
+
+	n := 0
+	assert.Nil(t, m.RangeBucket(0, func(k string, v int) bool {
+		n++
+		return false
+	}))
+	assert.Equal(t, 1, n)
+
+	for _, index := range []int{-1, 8, 100} {
+		err := m.RangeBucket(index, func(k string, v int) bool {
+			t.Fatal("f called for an invalid index")
+			return true
+		})
+		assert.ErrorIs(t, err, ErrBucketOutOfRange)
+	}
+}
+
+func TestCount(t *testing.T) {
+	m := NewIntegerMap[int, int]()
+	assert.Equal(t, 0, m.Count(func(k, v int) bool { return true }))
+
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i*2)
+	}
+
+	assert.Equal(t, m.Len(), m.Count(func(k, v int) bool { return true }))
+	assert.Equal(t, 0, m.Count(func(k, v int) bool { return false }))
+	assert.Equal(t, 500, m.Count(func(k, v int) bool { return k%2 == 0 }))
+	assert.Equal(t, 100, m.Count(func(k, v int) bool { return v < 200 }))
+
+	// Count while writers are running
+	var wg sync.WaitGroup
+	for i := 1000; i < 2000; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			m.Set(n, n*2)
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		n := m.Count(func(k, v int) bool { return true })
+		assert.True(t, n >= 1000 && n <= 2000)
+	}
+	wg.Wait()
+	assert.Equal(t, 2000, m.Count(func(k, v int) bool { return true }))
+}
+
+func TestMerge(t *testing.T) {
+	// disjoint keys
+	a := NewStringMap[string, int]()
+	b := NewStringMap[string, int]()
+	for i := 0; i < 100; i++ {
+		a.Set("a"+strconv.Itoa(i), i)
+		b.Set("b"+strconv.Itoa(i), i)
+	}
+	a.Merge(b, nil)
+	assert.Equal(t, 200, a.Len())
+	assert.Equal(t, 100, b.Len())
+	val, ok := a.Get("b42")
+	assert.True(t, ok)
+	assert.Equal(t, 42, val)
+
+	// overlapping keys with a custom resolver
+	c := NewStringMap[string, int]()
+	d := NewStringMap[string, int]()
+	c.Set("x", 1)
+	c.Set("y", 2)
+	d.Set("y", 10)
+	d.Set("z", 20)
+	c.Merge(d, func(existing, incoming int) int { return existing + incoming })
+	assert.Equal(t, 3, c.Len())
+	val, _ = c.Get("x")
+	assert.Equal(t, 1, val)
+	val, _ = c.Get("y")
+	assert.Equal(t, 12, val)
+	val, _ = c.Get("z")
+	assert.Equal(t, 20, val)
+
+	// nil resolver is last-write-wins
+	e := NewStringMap[string, int]()
+	e.Set("y", 2)
+	e.Merge(d, nil)
+	assert.Equal(t, 2, e.Len())
+	val, _ = e.Get("y")
+	assert.Equal(t, 10, val)
+}
+
+func TestEqual(t *testing.T) {
+	a := NewStringMap[string, int]()
+	b := NewStringMap[string, int](WithBuckets[string](2))
+	assert.True(t, EqualComparable(a, b))
+
+	for i := 0; i < 100; i++ {
+		a.Set(strconv.Itoa(i), i)
+		b.Set(strconv.Itoa(i), i)
+	}
+	assert.True(t, EqualComparable(a, b))
+	assert.True(t, EqualComparable(b, a))
+	assert.True(t, EqualComparable(a, a))
+	assert.True(t, a.Equal(b, func(x, y int) bool { return x == y }))
+
+	// different length
+	b.Set("extra", 1)
+	assert.False(t, EqualComparable(a, b))
+	assert.False(t, EqualComparable(b, a))
+
+	// same keys, different values
+	b.Delete("extra")
+	b.Set("42", -42)
+	assert.False(t, EqualComparable(a, b))
+	assert.True(t, a.Equal(b, func(x, y int) bool { return x == y || x == -y }))
+}
+
+func TestDifferenceAndIntersectionKeys(t *testing.T) {
+	a := NewStringMap[string, int]()
+	b := NewStringMap[string, int](WithBuckets[string](2))
+	for _, key := range []string{"a", "b", "c", "d"} {
+		a.Set(key, 1)
+	}
+	for _, key := range []string{"c", "d", "e"} {
+		b.Set(key, 2)
+	}
+
+	sorted := func(keys []string) []string {
+		sort.Strings(keys)
+		return keys
+	}
+	assert.Equal(t, []string{"a", "b"}, sorted(DifferenceKeys(a, b)))
+	assert.Equal(t, []string{"e"}, sorted(DifferenceKeys(b, a)))
+	assert.Equal(t, []string{"c", "d"}, sorted(IntersectionKeys(a, b)))
+	assert.Equal(t, []string{"c", "d"}, sorted(IntersectionKeys(b, a)))
+
+	// disjoint maps
+	c := NewStringMap[string, int]()
+	c.Set("x", 1)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, sorted(DifferenceKeys(a, c)))
+	assert.Empty(t, IntersectionKeys(a, c))
+
+	// a map against itself
+	assert.Empty(t, DifferenceKeys(a, a))
+	assert.Equal(t, []string{"a", "b", "c", "d"}, sorted(IntersectionKeys(a, a)))
+}
+
+func TestString(t *testing.T) {
+	m := NewStringMap[string, int]()
+	assert.Equal(t, "map[]", m.String())
+
+	m.Set("b", 2)
+	m.Set("a", 1)
+	m.Set("c", 3)
+	assert.Equal(t, "map[a:1 b:2 c:3]", m.String())
+	assert.Equal(t, "map[a:1 b:2 c:3]", fmt.Sprint(m))
+
 	for i := 0; i < 1000; i++ {
 		m.Set(strconv.Itoa(i), i)
 	}
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		m.Clear()
+	assert.True(t, strings.HasSuffix(m.String(), " ...]"))
+
+	// must not deadlock from within Range
+	m.Range(func(k string, v int) bool {
+		assert.Equal(t, "map[...]", m.String())
+		return false
+	})
+
+	// a write-locked bucket is skipped, not the buckets after it
+	n := NewIntegerMap[int, int](WithBuckets[int](2))
+	for i := 0; i < 4; i++ {
+		n.Set(i, i)
+	}
+	bucket := n.table.Load().buckets[0]
+	bucket.Lock()
+	assert.Equal(t, "map[1:1 2:2 3:3 ...]", n.String())
+	bucket.Unlock()
+	assert.Equal(t, "map[0:0 1:1 2:2 3:3]", n.String())
+}
+
+func TestIncr(t *testing.T) {
+	m := NewStringMap[string, int64]()
+	assert.Equal(t, int64(5), Incr(m, "a", 5))
+	assert.Equal(t, int64(3), Incr(m, "a", -2))
+	assert.Equal(t, 1, m.Len())
+
+	const workers, loops = 100, 1000
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < loops; j++ {
+				Incr(m, "total", 1)
+				Incr(m, strconv.Itoa(j%10), int64(n))
+			}
+		}(i)
+	}
+	wg.Wait()
+	assertCount(t, m)
+
+	val, _ := m.Get("total")
+	assert.Equal(t, int64(workers*loops), val)
+	// every worker adds its index loops/10 times to each of the 10 keys
+	val, _ = m.Get("7")
+	assert.Equal(t, int64(workers*(workers-1)/2*loops/10), val)
+	assert.Equal(t, 12, m.Len())
+}
+
+func TestCompareAndSwapFunc(t *testing.T) {
+	m := NewStringMap[string, []int]()
+	m.Set("a", []int{1, 2})
+	eq := func(a, b []int) bool { return reflect.DeepEqual(a, b) }
+
+	assert.False(t, m.CompareAndSwapFunc("a", []int{1}, []int{3}, eq))
+	val, _ := m.Get("a")
+	assert.Equal(t, []int{1, 2}, val)
+
+	assert.True(t, m.CompareAndSwapFunc("a", []int{1, 2}, []int{3}, eq))
+	val, _ = m.Get("a")
+	assert.Equal(t, []int{3}, val)
+
+	// missing keys are never swapped in
+	assert.False(t, m.CompareAndSwapFunc("b", nil, []int{1}, eq))
+	assert.False(t, m.Contains("b"))
+	assert.Equal(t, 1, m.Len())
+}
+
+func TestIncrMany(t *testing.T) {
+	m := NewStringMap[string, int64]()
+	m.Set("a", 10)
+	IncrMany(m, map[string]int64{"a": 5, "b": -2})
+	IncrMany(m, nil)
+	val, _ := m.Get("a")
+	assert.Equal(t, int64(15), val)
+	val, _ = m.Get("b")
+	assert.Equal(t, int64(-2), val)
+	assert.Equal(t, 2, m.Len())
+
+	const workers, loops = 100, 100
+	deltas := make(map[string]int64)
+	for i := 0; i < 50; i++ {
+		deltas[strconv.Itoa(i)] = int64(i)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < loops; j++ {
+				IncrMany(m, deltas)
+				Incr(m, "0", 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assertCount(t, m)
+
+	for key, delta := range deltas {
+		want := delta * workers * loops
+		if key == "0" {
+			want = workers * loops
+		}
+		val, _ := m.Get(key)
+		assert.Equal(t, want, val, key)
+	}
+	assert.Equal(t, 52, m.Len())
+}
+
+func TestCompareAndSwapPointer(t *testing.T) {
+	one, otherOne, two := new(int), new(int), new(int)
+	*one, *otherOne, *two = 1, 1, 2
+	m := NewStringMap[string, *int]()
+	m.Set("a", one)
+
+	// pointers compare by identity
+	assert.False(t, CompareAndSwap(m, "a", otherOne, two))
+	val, _ := m.Get("a")
+	assert.Same(t, one, val)
+	assert.True(t, CompareAndSwap(m, "a", one, two))
+	val, _ = m.Get("a")
+	assert.Same(t, two, val)
+	assert.False(t, CompareAndSwap(m, "b", nil, one))
+	assert.False(t, m.Contains("b"))
+
+	// a func compares pointees
+	pointee := func(a, b *int) bool { return *a == *b }
+	other := new(int)
+	*other = 2
+	assert.True(t, m.CompareAndSwapFunc("a", other, one, pointee))
+	val, _ = m.Get("a")
+	assert.Same(t, one, val)
+}
+
+func TestLoadAndUpdate(t *testing.T) {
+	m := NewStringMap[string, []int]()
+
+	val, loaded := m.LoadAndUpdate("a", func(old []int, exists bool) []int {
+		assert.False(t, exists)
+		assert.Nil(t, old)
+		return append(old, 1)
+	})
+	assert.False(t, loaded)
+	assert.Equal(t, []int{1}, val)
+	assert.Equal(t, 1, m.Len())
+
+	val, loaded = m.LoadAndUpdate("a", func(old []int, exists bool) []int {
+		assert.True(t, exists)
+		return append(old, 2)
+	})
+	assert.True(t, loaded)
+	assert.Equal(t, []int{1, 2}, val)
+	assert.Equal(t, 1, m.Len())
+
+	// concurrent appends must not lose updates
+	const N = 1000
+	var wg sync.WaitGroup
+	for i := 0; i < N; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			m.LoadAndUpdate("b", func(old []int, exists bool) []int {
+				return append(old, n)
+			})
+		}(i)
+	}
+	wg.Wait()
+	assertCount(t, m)
+
+	val, _ = m.Get("b")
+	assert.Len(t, val, N)
+	assert.Equal(t, 2, m.Len())
+}
+
+func TestWithHashSeed(t *testing.T) {
+	a := NewStringMap[string, int](WithHashSeed[string](1))
+	b := NewStringMap[string, int](WithHashSeed[string](2))
+	c := NewStringMap[string, int](WithHashSeed[string](1))
+	r := NewStringMap[string, int](WithRandomHashSeed[string]())
+
+	differs := 0
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		// the same seed shards stably
+		assert.Equal(t, a.hashIndex(key), a.hashIndex(key))
+		assert.Equal(t, a.hashIndex(key), c.hashIndex(key))
+		if a.hashIndex(key) != b.hashIndex(key) {
+			differs++
+		}
+		a.Set(key, i)
+		r.Set(key, i)
+	}
+	assert.Greater(t, differs, 500)
+
+	for i := 0; i < 1000; i++ {
+		val, ok := a.Get(strconv.Itoa(i))
+		assert.True(t, ok)
+		assert.Equal(t, i, val)
+		val, ok = r.Get(strconv.Itoa(i))
+		assert.True(t, ok)
+		assert.Equal(t, i, val)
+	}
+}
+
+func TestHashKeyFuncs(t *testing.T) {
+	for name, opt := range map[string]OptFunc[string]{
+		"xxhash":  HashStrKeyFunc(),
+		"fnv":     HashFNVKeyFunc(),
+		"maphash": HashMaphashKeyFunc(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			m, err := NewMap[string, int](opt)
+			assert.Nil(t, err)
+			for i := 0; i < 1000; i++ {
+				m.Set(strconv.Itoa(i), i)
+			}
+			assert.Equal(t, 1000, m.Len())
+			for i := 0; i < 1000; i++ {
+				val, ok := m.Get(strconv.Itoa(i))
+				assert.True(t, ok)
+				assert.Equal(t, i, val)
+			}
+		})
+	}
+
+	// FNV-1a test vectors
+	assert.Equal(t, uint64(0xcbf29ce484222325), HashFNV(""))
+	assert.Equal(t, uint64(0xaf63dc4c8601ec8c), HashFNV("a"))
+	assert.Equal(t, HashMaphash("hello"), HashMaphash("hello"))
+}
+
+func TestMaxByMinBy(t *testing.T) {
+	m := NewStringMap[string, int]()
+	less := func(a, b int) bool { return a < b }
+
+	_, _, ok := MaxBy(m, less)
+	assert.False(t, ok)
+	_, _, ok = MinBy(m, less)
+	assert.False(t, ok)
+
+	for i, key := range []string{"a", "b", "c", "d", "e"} {
+		m.Set(key, (i*3)%5)
+	}
+	key, val, ok := MaxBy(m, less)
+	assert.True(t, ok)
+	assert.Equal(t, "d", key)
+	assert.Equal(t, 4, val)
+	key, val, ok = MinBy(m, less)
+	assert.True(t, ok)
+	assert.Equal(t, "a", key)
+	assert.Equal(t, 0, val)
+
+	// a custom comparator: by distance from 2
+	dist := func(a, b int) bool { return abs(a-2) < abs(b-2) }
+	key, _, _ = MinBy(m, dist)
+	assert.Equal(t, "e", key)
+	_, val, _ = MaxBy(m, dist)
+	assert.Contains(t, []int{0, 4}, val)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func TestTransform(t *testing.T) {
+	m := NewStringMap[string, int](WithBuckets[string](3))
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+
+	s := Transform(m, func(k string, v int) string { return k + "=" + strconv.Itoa(v*2) })
+	assert.Equal(t, 100, s.Len())
+	assert.Equal(t, m.BucketCount(), s.BucketCount())
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		val, ok := s.Get(key)
+		assert.True(t, ok)
+		assert.Equal(t, key+"="+strconv.Itoa(i*2), val)
+		assert.Equal(t, m.hashIndex(key), s.hashIndex(key))
+	}
+
+	// the result is independent of the source
+	s.Set("new", "x")
+	s.Delete("0")
+	assert.Equal(t, 100, m.Len())
+	assert.False(t, m.Contains("new"))
+	assert.Equal(t, 100, s.Len())
+
+	assert.True(t, Transform(NewStringMap[string, int](), func(k string, v int) bool { return true }).IsEmpty())
+}
+
+func TestDefaultHashFunc(t *testing.T) {
+	type ID struct {
+		Name string
+		N    int
+	}
+	type Name string
+
+	str := DefaultHashFunc[string]()
+	assert.Equal(t, str("hello"), str("hello"))
+	assert.NotEqual(t, str("hello"), str("world"))
+	assert.Equal(t, HashMaphash("hello"), str("hello"))
+	assert.Equal(t, str("a"), DefaultHashFunc[Name]()("a"))
+
+	i := DefaultHashFunc[int]()
+	assert.Equal(t, i(42), i(42))
+	assert.NotEqual(t, i(42), i(43))
+	i8 := DefaultHashFunc[int8]()
+	assert.Equal(t, i8(-1), i8(-1))
+	assert.NotEqual(t, i8(1), i8(2))
+
+	f := DefaultHashFunc[float32]()
+	assert.Equal(t, f(float32(math.Copysign(0, -1))), f(0))
+	assert.NotEqual(t, f(1.5), f(2.5))
+
+	s := DefaultHashFunc[ID]()
+	assert.Equal(t, s(ID{"a", 1}), s(ID{"a", 1}))
+	assert.NotEqual(t, s(ID{"a", 1}), s(ID{"a", 2}))
+
+	a, b := new(int), new(int)
+	p := DefaultHashFunc[*int]()
+	assert.Equal(t, p(a), p(a))
+	assert.NotEqual(t, p(a), p(b))
+
+	iface := DefaultHashFunc[any]()
+	assert.Equal(t, iface("x"), iface("x"))
+	assert.Equal(t, iface(nil), iface(nil))
+
+	m, err := NewMap[ID, int](WithHashFunc(DefaultHashFunc[ID]()))
+	assert.Nil(t, err)
+	for n := 0; n < 100; n++ {
+		m.Set(ID{strconv.Itoa(n), n}, n)
+	}
+	val, ok := m.Get(ID{"7", 7})
+	assert.True(t, ok)
+	assert.Equal(t, 7, val)
+	assert.Equal(t, 100, m.Len())
+}
+
+func TestRangeContext(t *testing.T) {
+	m := NewIntegerMap[int, int](WithBuckets[int](2))
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+	}
+
+	count := 0
+	err := m.RangeContext(context.Background(), func(k, v int) bool {
+		count++
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 10000, count)
+
+	// early termination by f
+	count = 0
+	err = m.RangeContext(context.Background(), func(k, v int) bool {
+		count++
+		return count < 5
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, count)
+
+	// cancel mid-iteration
+	ctx, cancel := context.WithCancel(context.Background())
+	count = 0
+	err = m.RangeContext(ctx, func(k, v int) bool {
+		count++
+		if count == 10 {
+			cancel()
+		}
+		return true
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, count, 10+ctxCheckInterval)
+
+	// locks are released
+	m.Set(-1, -1)
+	assert.Equal(t, 10001, m.Len())
+
+	err = m.RangeContext(ctx, func(k, v int) bool {
+		t.Fatal("f called with a cancelled context")
+		return true
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestStream(t *testing.T) {
+	m := NewIntegerMap[int, int](WithBuckets[int](2))
+	want := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i*2)
+		want[i] = i * 2
+	}
+
+	got := make(map[int]int)
+	for e := range m.Stream() {
+		got[e.Key] = e.Value
+		// no lock is held between sends
+		m.Set(-1, -1)
+		m.Delete(-1)
+	}
+	assert.Equal(t, want, got)
+
+	// cancel mid-stream
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := m.StreamContext(ctx)
+	<-ch
+	cancel()
+	n := 0
+	for range ch {
+		n++
+	}
+	assert.Less(t, n, 1000)
+
+	// empty map
+	n = 0
+	for range NewIntegerMap[int, int]().Stream() {
+		n++
+	}
+	assert.Equal(t, 0, n)
+}
+
+func TestDrainStream(t *testing.T) {
+	var deletes atomic.Int32
+	m := NewIntegerMap[int, int](WithBuckets[int](2), WithOnDelete(func(int) { deletes.Add(1) }))
+	want := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i*2)
+		want[i] = i * 2
+	}
+
+	got := make(map[int]int)
+	for e := range m.DrainStream() {
+		got[e.Key] = e.Value
+		// no lock is held between sends
+		m.Contains(e.Key)
+	}
+	assert.Equal(t, want, got)
+	assert.True(t, m.IsEmpty())
+	assert.Equal(t, int32(1000), deletes.Load())
+
+	n := 0
+	for range m.DrainStream() {
+		n++
+	}
+	assert.Equal(t, 0, n)
+}
+
+func TestDrainStreamGrowth(t *testing.T) {
+	m := NewIntegerMap[int, int](WithBuckets[int](0), WithLoadFactor[int](4))
+	for i := 0; i < 3; i++ {
+		m.Set(i, i)
+	}
+	got := make(map[int]int)
+	for e := range m.DrainStream() {
+		got[e.Key] = e.Value
+		if e.Key < 3 {
+			// grow the map while it is drained
+			for i := 100; i < 200; i++ {
+				m.Set(i+e.Key*100, i)
+			}
+		}
+	}
+	assert.Greater(t, m.BucketCount(), 1)
+	assert.Equal(t, 3+300, len(got)+m.Len())
+	// every entry was either received or is still in the map, never both
+	for key := range got {
+		assert.False(t, m.Contains(key), key)
+	}
+	for key := range m.ToMap() {
+		_, received := got[key]
+		assert.False(t, received, key)
+	}
+}
+
+func TestObservers(t *testing.T) {
+	var mu sync.Mutex
+	sets := make(map[string]int)
+	deletes := make(map[string]int)
+	var m *SafeMap[string, int]
+	m = NewStringMap[string, int](
+		WithOnSet(func(key string) {
+			mu.Lock()
+			sets[key]++
+			mu.Unlock()
+		}),
+		WithOnDelete(func(key string) {
+			// the bucket lock is already released
+			_, ok := m.Get(key)
+			assert.False(t, ok)
+			mu.Lock()
+			deletes[key]++
+			mu.Unlock()
+		}),
+	)
+
+	m.Set("a", 1)
+	m.Set("a", 2)
+	m.GetOrSet("a", 3) // loaded, no store
+	m.GetOrSet("b", 1)
+	Incr(m, "c", 1)
+	m.LoadAndUpdate("c", func(old int, exists bool) int { return old + 1 })
+	assert.Equal(t, map[string]int{"a": 2, "b": 1, "c": 2}, sets)
+
+	m.Delete("missing")
+	m.GetAndDelete("missing")
+	assert.Empty(t, deletes)
+	m.Delete("a")
+	m.GetAndDelete("b")
+	m.Clear()
+	assert.Equal(t, map[string]int{"a": 1, "b": 1, "c": 1}, deletes)
+
+	other := NewStringMap[string, int]()
+	other.Set("x", 1)
+	other.Set("y", 1)
+	m.Merge(other, nil)
+	assert.Equal(t, 1, sets["x"])
+	assert.Equal(t, 1, sets["y"])
+
+	// concurrent writes fire once per state change
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			key := "k" + strconv.Itoa(n)
+			m.Set(key, n)
+			m.Delete(key)
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 100; i++ {
+		key := "k" + strconv.Itoa(i)
+		assert.Equal(t, 1, sets[key])
+		assert.Equal(t, 1, deletes[key])
+	}
+}
+
+func TestWithValueCopier(t *testing.T) {
+	type profile struct {
+		Tags []string
+	}
+	copier := func(p *profile) *profile {
+		return &profile{Tags: append([]string(nil), p.Tags...)}
+	}
+	m := NewStringMap[string, *profile](WithValueCopier[string](copier), WithBuckets[string](0), WithLoadFactor[string](2))
+	m.Set("a", &profile{Tags: []string{"x"}})
+
+	p, _ := m.Get("a")
+	p.Tags[0] = "changed"
+	p, _ = m.Get("a")
+	assert.Equal(t, []string{"x"}, p.Tags)
+
+	m.Range(func(k string, v *profile) bool {
+		v.Tags[0] = "changed"
+		return true
+	})
+	m.ToMap()["a"].Tags[0] = "changed"
+	m.GetMultiple([]string{"a"})["a"].Tags[0] = "changed"
+	p, _ = m.Get("a")
+	assert.Equal(t, []string{"x"}, p.Tags)
+
+	// the copier survives a table replacement
+	for i := 0; i < 10; i++ {
+		m.Set(strconv.Itoa(i), &profile{})
+	}
+	assert.Greater(t, m.BucketCount(), 1)
+	p, _ = m.Get("a")
+	p.Tags[0] = "changed"
+	p, _ = m.Get("a")
+	assert.Equal(t, []string{"x"}, p.Tags)
+
+	// the other read paths hand out copies too
+	_, p, _ = MaxBy(m, func(a, b *profile) bool { return len(a.Tags) < len(b.Tags) })
+	p.Tags[0] = "changed"
+	p, _ = m.Unsafe().Get("a")
+	p.Tags[0] = "changed"
+	m.Count(func(k string, v *profile) bool {
+		if len(v.Tags) > 0 {
+			v.Tags[0] = "changed"
+		}
+		return true
+	})
+	Transform(m, func(k string, v *profile) int {
+		if len(v.Tags) > 0 {
+			v.Tags[0] = "changed"
+		}
+		return 0
+	})
+	p, _ = m.Get("a")
+	assert.Equal(t, []string{"x"}, p.Tags)
+
+	// as do the loaded paths of writes
+	p, _ = m.GetOrSet("a", nil)
+	p.Tags[0] = "changed"
+	p, _ = m.GetOrSetWithExpiry("a", nil, time.Hour)
+	p.Tags[0] = "changed"
+	assert.Nil(t, m.Transact([]string{"a"}, func(view map[string]*profile) (map[string]*profile, []string) {
+		view["a"].Tags[0] = "changed"
+		return nil, nil
+	}))
+	p, _ = m.Get("a")
+	assert.Equal(t, []string{"x"}, p.Tags)
+
+	// a copier for another value type
+	_, err := NewMap[string, profile](HashStrKeyFunc(), WithValueCopier[string](copier))
+	assert.ErrorIs(t, err, ErrValueCopierType)
+	assert.ErrorIs(t, m.Reset(HashStrKeyFunc(), WithValueCopier[string](func(s string) string { return s })), ErrValueCopierType)
+}
+
+func TestClearContext(t *testing.T) {
+	var deleted atomic.Int32
+	m := NewIntegerMap[int, int](WithBuckets[int](1), WithOnDelete(func(int) { deleted.Add(1) }))
+	for i := 0; i < 10; i++ {
+		m.Set(i, i)
+	}
+	assert.Nil(t, m.ClearContext(context.Background()))
+	assert.Equal(t, 0, m.Len())
+	assert.Equal(t, int32(10), deleted.Load())
+
+	for i := 0; i < 10; i++ {
+		m.Set(i, i)
+	}
+	// hold bucket 1, holding the odd keys, so the clear stops there
+	bucket := m.table.Load().buckets[1]
+	bucket.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := m.ClearContext(ctx)
+	bucket.Unlock()
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "cleared 1 of 2 buckets")
+	assert.Equal(t, 5, m.Len())
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, i%2 == 1, m.Contains(i))
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, m.ClearContext(ctx), context.Canceled)
+	assert.Equal(t, 5, m.Len())
+}
+
+func TestClearAndShrink(t *testing.T) {
+	deleted := 0
+	m := NewIntegerMap[int, [64]byte](WithOnDelete(func(int) { deleted++ }))
+	const N = 100000
+	for i := 0; i < N; i++ {
+		m.Set(i, [64]byte{})
+	}
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	m.ClearAndShrink()
+	assert.Equal(t, 0, m.Len())
+	assert.True(t, m.IsEmpty())
+	assert.Equal(t, N, deleted)
+
+	runtime.GC()
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	assert.Less(t, after.HeapInuse, before.HeapInuse)
+
+	// the map is still usable
+	m.Set(1, [64]byte{1})
+	val, ok := m.Get(1)
+	assert.True(t, ok)
+	assert.Equal(t, byte(1), val[0])
+	assert.Equal(t, 1, m.Len())
+}
+
+func TestReset(t *testing.T) {
+	m := NewStringMap[string, int](WithBuckets[string](2))
+	for i := 0; i < 100; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	alias := m
+
+	err := m.Reset(HashFNVKeyFunc(), WithBuckets[string](6))
+	assert.Nil(t, err)
+	assert.True(t, alias.IsEmpty())
+	assert.Equal(t, 64, alias.BucketCount())
+	_, ok := alias.Get("1")
+	assert.False(t, ok)
+	alias.Set("a", 1)
+	assert.Equal(t, 1, m.Len())
+	assert.Equal(t, int(HashFNV("a")&63), m.hashIndex("a"))
+
+	// invalid options leave the map unchanged
+	err = m.Reset()
+	assert.ErrorIs(t, err, ErrMissingHashFunc)
+	assert.Equal(t, 64, m.BucketCount())
+	assert.Equal(t, 1, m.Len())
+}
+
+func TestResetConcurrent(t *testing.T) {
+	m := NewIntegerMap[int, int]()
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				m.Set(i, i)
+				m.Get(i)
+				m.Len()
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, m.Reset(WithHashFunc(func(k int) uint64 { return uint64(k) }), WithBuckets[int](uint8(i%4))))
+	}
+	wg.Wait()
+	assertCount(t, m)
+
+	// every write after the last Reset landed in the current table
+	n := 0
+	for _, bucket := range m.table.Load().buckets {
+		n += len(bucket.innerMap)
+	}
+	assert.Equal(t, n, m.Len())
+}
+
+func TestResetDuringCallbacks(t *testing.T) {
+	// callbacks that call back into the map while another goroutine resets
+	// it must not deadlock
+	run := func(t *testing.T, m *SafeMap[int, int], options []OptFunc[int], op func()) {
+		options = append(options, WithHashFunc(func(k int) uint64 { return uint64(k) }))
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					assert.Nil(t, m.Reset(options...))
+				}
+			}()
+			for i := 0; i < 200; i++ {
+				op()
+			}
+			wg.Wait()
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("deadlocked")
+		}
+	}
+
+	t.Run("OnSet during SetAll", func(t *testing.T) {
+		var m *SafeMap[int, int]
+		options := []OptFunc[int]{WithOnSet(func(int) {
+			time.Sleep(10 * time.Microsecond)
+			m.Len()
+		})}
+		m = NewIntegerMap[int, int](options...)
+		run(t, m, options, func() {
+			m.SetAll(map[int]int{1: 1, 2: 2, 3: 3})
+		})
+	})
+
+	t.Run("RangeSnapshot", func(t *testing.T) {
+		m := NewIntegerMap[int, int]()
+		run(t, m, nil, func() {
+			m.Set(1, 1)
+			m.Set(2, 2)
+			m.RangeSnapshot(func(k, v int) bool {
+				time.Sleep(10 * time.Microsecond)
+				m.Len()
+				return true
+			})
+		})
+	})
+}
+
+func TestGrow(t *testing.T) {
+	m := NewIntegerMap[int, int]()
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	m.Grow(10000)
+	m.Grow(0)
+	m.Grow(-1)
+	assert.Equal(t, 100, m.Len())
+	for i := 0; i < 100; i++ {
+		val, ok := m.Get(i)
+		assert.True(t, ok)
+		assert.Equal(t, i, val)
+	}
+	for i := 100; i < 10000; i++ {
+		m.Set(i, i)
+	}
+	assert.Equal(t, 10000, m.Len())
+}
+
+func TestWithLoadFactor(t *testing.T) {
+	m := NewIntegerMap[int, int](WithBuckets[int](1), WithLoadFactor[int](8))
+	assert.Equal(t, 2, m.BucketCount())
+
+	const N = 4000
+	for i := 0; i < N; i++ {
+		m.Set(i, i)
+	}
+	buckets := m.BucketCount()
+	assert.Greater(t, buckets, 2)
+	assert.LessOrEqual(t, N/buckets, 8)
+	assert.Equal(t, N, m.Len())
+	for i := 0; i < N; i++ {
+		val, ok := m.Get(i)
+		assert.True(t, ok)
+		assert.Equal(t, i, val)
+	}
+
+	// growth never exceeds the max bucket count
+	for i := N; i < 20*maxBucketCount; i++ {
+		m.Set(i, i)
+	}
+	assert.Equal(t, maxBucketCount, m.BucketCount())
+	assert.Equal(t, 20*maxBucketCount, m.Len())
+
+	// without a load factor the bucket count is fixed
+	fixed := NewIntegerMap[int, int](WithBuckets[int](1))
+	for i := 0; i < N; i++ {
+		fixed.Set(i, i)
+	}
+	assert.Equal(t, 2, fixed.BucketCount())
+}
+
+func TestWithLoadFactorConcurrent(t *testing.T) {
+	m := NewStringMap[string, int](WithBuckets[string](0), WithLoadFactor[string](4))
+
+	const N = 20000
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < N; i += 8 {
+				m.Set(strconv.Itoa(i), i)
+				if i%3 == 0 {
+					Incr(m, "counter", 1)
+				}
+				if i%100 == 0 {
+					m.Count(func(k string, v int) bool { return true })
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	assertCount(t, m)
+
+	assert.Greater(t, m.BucketCount(), 1)
+	assert.Equal(t, N+1, m.Len())
+	for i := 0; i < N; i++ {
+		val, ok := m.Get(strconv.Itoa(i))
+		assert.True(t, ok)
+		assert.Equal(t, i, val)
+	}
+	val, _ := m.Get("counter")
+	assert.Equal(t, (N+2)/3, val)
+}
+
+func TestTransact(t *testing.T) {
+	m := NewStringMap[string, int](WithBuckets[string](3))
+
+	// pick account keys spread over several buckets
+	var accounts []string
+	buckets := make(map[int]bool)
+	for i := 0; len(buckets) < 4; i++ {
+		key := "acct" + strconv.Itoa(i)
+		if !buckets[m.hashIndex(key)] {
+			buckets[m.hashIndex(key)] = true
+			accounts = append(accounts, key)
+		}
+	}
+	for _, key := range accounts {
+		m.Set(key, 100)
+	}
+	const total = 400
+
+	err := m.Transact(accounts, func(view map[string]int) (map[string]int, []string) {
+		assert.Len(t, view, 4)
+		return nil, nil
+	})
+	assert.Nil(t, err)
+
+	// concurrent transfers keep the total constant for every reader
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				from, to := accounts[(w+i)%4], accounts[(w+i+1)%4]
+				err := m.Transact([]string{from, to}, func(view map[string]int) (map[string]int, []string) {
+					return map[string]int{from: view[from] - 1, to: view[to] + 1}, nil
+				})
+				assert.Nil(t, err)
+			}
+		}(w)
+	}
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				m.Transact(accounts, func(view map[string]int) (map[string]int, []string) {
+					sum := 0
+					for _, val := range view {
+						sum += val
+					}
+					assert.Equal(t, total, sum)
+					return nil, nil
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	assertCount(t, m)
+
+	sum := 0
+	for _, key := range accounts {
+		val, _ := m.Get(key)
+		sum += val
+	}
+	assert.Equal(t, total, sum)
+
+	// inserts and deletes keep Len accurate
+	err = m.Transact([]string{accounts[0], "new"}, func(view map[string]int) (map[string]int, []string) {
+		_, ok := view["new"]
+		assert.False(t, ok)
+		return map[string]int{"new": view[accounts[0]]}, []string{accounts[0]}
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, m.Len())
+	_, ok := m.Get(accounts[0])
+	assert.False(t, ok)
+
+	// writing outside the locked keys applies nothing
+	err = m.Transact([]string{"new"}, func(view map[string]int) (map[string]int, []string) {
+		return map[string]int{"new": 0, "other": 1}, nil
+	})
+	assert.ErrorIs(t, err, ErrKeyNotInTransaction)
+	err = m.Transact([]string{"new"}, func(view map[string]int) (map[string]int, []string) {
+		return nil, []string{"other"}
+	})
+	assert.ErrorIs(t, err, ErrKeyNotInTransaction)
+	val, _ := m.Get("new")
+	assert.NotEqual(t, 0, val)
+	_, ok = m.Get("other")
+	assert.False(t, ok)
+	assert.Equal(t, 4, m.Len())
+}
+
+func TestRename(t *testing.T) {
+	var sets, deletes []int
+	m := NewIntegerMap[int, string](
+		WithBuckets[int](2),
+		WithOnSet(func(k int) { sets = append(sets, k) }),
+		WithOnDelete(func(k int) { deletes = append(deletes, k) }),
+	)
+	m.Set(1, "one")
+	m.Set(3, "three")
+	sets = nil
+
+	// across buckets 1 and 2
+	assert.True(t, m.Rename(1, 2))
+	assert.False(t, m.Contains(1))
+	val, _ := m.Get(2)
+	assert.Equal(t, "one", val)
+	assert.Equal(t, 2, m.Len())
+	assert.Equal(t, []int{2}, sets)
+	assert.Equal(t, []int{1}, deletes)
+
+	// within bucket 2, overwriting 6
+	m.Set(6, "six")
+	assert.True(t, m.Rename(2, 6))
+	assert.False(t, m.Contains(2))
+	val, _ = m.Get(6)
+	assert.Equal(t, "one", val)
+	assert.Equal(t, 2, m.Len())
+
+	// missing old key
+	assert.False(t, m.Rename(100, 3))
+	val, _ = m.Get(3)
+	assert.Equal(t, "three", val)
+	assert.Equal(t, 2, m.Len())
+
+	// to itself
+	assert.True(t, m.Rename(3, 3))
+	assert.False(t, m.Rename(100, 100))
+	assert.Equal(t, 2, m.Len())
+}
+
+func TestRenameConcurrent(t *testing.T) {
+	m := NewIntegerMap[int, int]()
+	m.Set(0, 42)
+
+	// a value passed back and forth is always under exactly one key
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			m.Rename(0, 1)
+			m.Rename(1, 0)
+		}
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			wg.Wait()
+			assert.Equal(t, 1, m.Len())
+			return
+		default:
+			assert.Len(t, m.GetMultiple([]int{0, 1}), 1)
+		}
+	}
+}
+
+func TestRangeSorted(t *testing.T) {
+	strMap := NewStringMap[string, int]()
+	for _, key := range []string{"d", "b", "e", "a", "c"} {
+		strMap.Set(key, int(key[0]))
+	}
+	var keys []string
+	strMap.RangeSorted(func(a, b string) bool { return a < b }, func(k string, v int) bool {
+		assert.Equal(t, int(k[0]), v)
+		keys = append(keys, k)
+		return true
+	})
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, keys)
+
+	intMap := NewIntegerMap[int, int]()
+	for i := 100; i > 0; i-- {
+		intMap.Set(i, i)
+	}
+	var ints []int
+	intMap.RangeSorted(func(a, b int) bool { return a < b }, func(k, v int) bool {
+		ints = append(ints, k)
+		return k < 5
+	})
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, ints)
+
+	// keys deleted during the iteration are skipped
+	ints = ints[:0]
+	intMap.RangeSorted(func(a, b int) bool { return a > b }, func(k, v int) bool {
+		intMap.Delete(k - 1)
+		ints = append(ints, k)
+		return k > 90
+	})
+	assert.Equal(t, []int{100, 98, 96, 94, 92, 90}, ints)
+}
+
+func TestRangeUpdate(t *testing.T) {
+	var sets, deletes int
+	m := NewIntegerMap[int, int](WithOnSet(func(int) { sets++ }), WithOnDelete(func(int) { deletes++ }))
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	sets = 0
+
+	m.RangeUpdate(func(k, v int) (int, Action) {
+		switch {
+		case v%2 == 0:
+			return 0, ActionDelete
+		case v%3 == 0:
+			return 0, ActionKeep
+		default:
+			return v * 10, ActionUpdate
+		}
+	})
+
+	assert.Equal(t, 50, m.Len())
+	assert.Equal(t, 50, deletes)
+	for i := 0; i < 100; i++ {
+		val, ok := m.Get(i)
+		switch {
+		case i%2 == 0:
+			assert.False(t, ok)
+		case i%3 == 0:
+			assert.Equal(t, i, val)
+		default:
+			assert.Equal(t, i*10, val)
+		}
+	}
+	assert.Equal(t, 33, sets)
+}
+
+func TestDeleteIf(t *testing.T) {
+	m := NewIntegerMap[int, int]()
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+
+	assert.Equal(t, 0, m.DeleteIf(func(k, v int) bool { return k < 0 }))
+	assert.Equal(t, 500, m.DeleteIf(func(k, v int) bool { return v%2 == 1 }))
+	assert.Equal(t, 500, m.Len())
+	m.Range(func(k, v int) bool {
+		assert.Equal(t, 0, v%2)
+		return true
+	})
+	assert.True(t, m.Contains(0))
+	assert.False(t, m.Contains(1))
+
+	assert.Equal(t, 500, m.DeleteIf(func(k, v int) bool { return true }))
+	assert.True(t, m.IsEmpty())
+}
+
+func TestTakeIf(t *testing.T) {
+	m := NewIntegerMap[int, int]()
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	even := func(k, v int) bool { return v%2 == 0 }
+
+	taken := m.TakeIf(even, 10)
+	assert.Len(t, taken, 10)
+	for key, val := range taken {
+		assert.Equal(t, key, val)
+		assert.Zero(t, val%2)
+		assert.False(t, m.Contains(key))
+	}
+	assert.Equal(t, 90, m.Len())
+
+	taken = m.TakeIf(even, 0)
+	assert.Len(t, taken, 40)
+	assert.Equal(t, 50, m.Len())
+	assert.Empty(t, m.TakeIf(even, 0))
+}
+
+func TestTakeIfConcurrent(t *testing.T) {
+	m := NewIntegerMap[int, int]()
+	const n = 10000
+	for i := 0; i < n; i++ {
+		m.Set(i, i)
+	}
+
+	var mu sync.Mutex
+	seen := make(map[int]int)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				taken := m.TakeIf(func(k, v int) bool { return true }, 16)
+				if len(taken) == 0 {
+					return
+				}
+				mu.Lock()
+				for key := range taken {
+					seen[key]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assertCount(t, m)
+
+	assert.Len(t, seen, n)
+	for key, times := range seen {
+		assert.Equal(t, 1, times, key)
+	}
+	assert.True(t, m.IsEmpty())
+}
+
+func TestEstimateMemory(t *testing.T) {
+	m := NewIntegerMap[int64, [16]byte]()
+	empty := m.EstimateMemory()
+	assert.Greater(t, empty, int64(0))
+
+	for i := 0; i < 1000; i++ {
+		m.Set(int64(i), [16]byte{})
+	}
+	thousand := m.EstimateMemory()
+	for i := 1000; i < 2000; i++ {
+		m.Set(int64(i), [16]byte{})
+	}
+	twoThousand := m.EstimateMemory()
+
+	assert.Equal(t, int64(1000*(8+16)), thousand-empty)
+	assert.Equal(t, thousand-empty, twoThousand-thousand)
+}
+
+func BenchmarkSafeMapClear(b *testing.B) {
+	m, _ := NewMap[string, int](WithHashFunc(func(s string) uint64 { return Hashstr(s) }))
+	for i := 0; i < 1000; i++ {
+		m.Set(strconv.Itoa(i), i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Clear()
+	}
+}
+
+func benchmarkSafeMapBulkSet(b *testing.B, grow bool) {
+	for i := 0; i < b.N; i++ {
+		m, _ := NewMap[string, int](HashStrKeyFunc())
+		if grow {
+			m.Grow(len(parallelKeys))
+		}
+		for j, key := range parallelKeys {
+			m.Set(key, j)
+		}
+	}
+}
+
+func BenchmarkSafeMapBulkSet(b *testing.B) {
+	benchmarkSafeMapBulkSet(b, false)
+}
+
+func BenchmarkSafeMapBulkSetAfterGrow(b *testing.B) {
+	benchmarkSafeMapBulkSet(b, true)
+}
+
+var incrDeltas = func() map[string]int64 {
+	deltas := make(map[string]int64, 256)
+	for i := 0; i < 256; i++ {
+		deltas[strconv.Itoa(i)] = 1
+	}
+	return deltas
+}()
+
+func BenchmarkIncr(b *testing.B) {
+	m := NewStringMap[string, int64]()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			for key, delta := range incrDeltas {
+				Incr(m, key, delta)
+			}
+		}
+	})
+}
+
+func BenchmarkIncrMany(b *testing.B) {
+	m := NewStringMap[string, int64]()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			IncrMany(m, incrDeltas)
+		}
+	})
+}
+
+var setAllSrc = func() map[string]int {
+	src := make(map[string]int, len(parallelKeys))
+	for i, key := range parallelKeys {
+		src[key] = i
+	}
+	return src
+}()
+
+func BenchmarkSetLoop(b *testing.B) {
+	m := NewStringMap[string, int]()
+	for i := 0; i < b.N; i++ {
+		for key, val := range setAllSrc {
+			m.Set(key, val)
+		}
+	}
+}
+
+func BenchmarkSetAll(b *testing.B) {
+	m := NewStringMap[string, int]()
+	for i := 0; i < b.N; i++ {
+		m.SetAll(setAllSrc)
 	}
 }
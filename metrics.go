@@ -0,0 +1,97 @@
+package safemap
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// MapMetrics is a snapshot of the counters recorded by a map created with
+// WithMetrics. Counters cover single-key operations only.
+type MapMetrics struct {
+	// Gets counts calls of Get, GetOrDefault, Contains, TryGet and GetWithLock
+	Gets uint64
+	// Sets counts calls of Set, GetAndSet, SetAndReport, GetOrSet,
+	// GetOrSetActual, LoadAndUpdate, CompareAndSwapFunc and Incr, and the
+	// entries written by Merge
+	Sets uint64
+	// Deletes counts calls of Delete and GetAndDelete
+	Deletes uint64
+	// LockWaits counts bucket lock acquisitions that had to block
+	LockWaits uint64
+	// LockWaitTime is the total time spent blocked in those acquisitions
+	LockWaitTime time.Duration
+}
+
+// mapMetrics holds the live counters behind MapMetrics.
+// All methods are no-ops on a nil receiver, which is how a map without
+// WithMetrics stores it.
+type mapMetrics struct {
+	gets, sets, deletes atomic.Uint64
+	lockWaits           atomic.Uint64
+	lockWaitNanos       atomic.Int64
+}
+
+func (mm *mapMetrics) addGet() {
+	if mm != nil {
+		mm.gets.Add(1)
+	}
+}
+
+func (mm *mapMetrics) addSet() {
+	if mm != nil {
+		mm.sets.Add(1)
+	}
+}
+
+func (mm *mapMetrics) addDelete() {
+	if mm != nil {
+		mm.deletes.Add(1)
+	}
+}
+
+// lock write-locks mu, sampling the wait if the lock is held by others
+func (mm *mapMetrics) lock(mu *bucketLock) {
+	if mm == nil {
+		mu.Lock()
+		return
+	}
+	if !mu.TryLock() {
+		start := time.Now()
+		mu.Lock()
+		mm.addWait(start)
+	}
+}
+
+// rlock read-locks mu, sampling the wait if the lock is held by a writer
+func (mm *mapMetrics) rlock(mu *bucketLock) {
+	if mm == nil {
+		mu.RLock()
+		return
+	}
+	if !mu.TryRLock() {
+		start := time.Now()
+		mu.RLock()
+		mm.addWait(start)
+	}
+}
+
+func (mm *mapMetrics) addWait(start time.Time) {
+	mm.lockWaits.Add(1)
+	mm.lockWaitNanos.Add(int64(time.Since(start)))
+}
+
+// Metrics returns a snapshot of the map's operation and lock-wait counters.
+// It returns zero values unless the map was created with WithMetrics.
+func (m *SafeMap[K, V]) Metrics() MapMetrics {
+	mm := m.table.Load().metrics
+	if mm == nil {
+		return MapMetrics{}
+	}
+	return MapMetrics{
+		Gets:         mm.gets.Load(),
+		Sets:         mm.sets.Load(),
+		Deletes:      mm.deletes.Load(),
+		LockWaits:    mm.lockWaits.Load(),
+		LockWaitTime: time.Duration(mm.lockWaitNanos.Load()),
+	}
+}
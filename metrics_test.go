@@ -0,0 +1,65 @@
+package safemap
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewStringMap[string, int](WithMetrics[string]())
+	m.Set("a", 1)
+	m.GetAndSet("a", 2)
+	m.GetOrSet("b", 3)
+	m.LoadAndUpdate("c", func(old int, exists bool) int { return old + 1 })
+	Incr(m, "d", 1)
+	m.Get("a")
+	m.GetOrDefault("x", 0)
+	m.Contains("b")
+	m.Delete("a")
+	m.GetAndDelete("b")
+
+	metrics := m.Metrics()
+	assert.Equal(t, uint64(5), metrics.Sets)
+	assert.Equal(t, uint64(3), metrics.Gets)
+	assert.Equal(t, uint64(2), metrics.Deletes)
+
+	// counters survive a table replacement
+	g := NewIntegerMap[int, int](WithBuckets[int](0), WithLoadFactor[int](2), WithMetrics[int]())
+	for i := 0; i < 100; i++ {
+		g.Set(i, i)
+	}
+	assert.Greater(t, g.BucketCount(), 1)
+	assert.Equal(t, uint64(100), g.Metrics().Sets)
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	m := NewStringMap[string, int]()
+	m.Set("a", 1)
+	m.Get("a")
+	m.Delete("a")
+	assert.Equal(t, MapMetrics{}, m.Metrics())
+}
+
+func TestMetricsLockWaits(t *testing.T) {
+	m := NewStringMap[string, int](WithBuckets[string](0), WithMetrics[string]())
+
+	// hold the only bucket so that the Set below has to block
+	bucket := m.table.Load().buckets[0]
+	bucket.Lock()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.Set("a", 1)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	bucket.Unlock()
+	wg.Wait()
+
+	metrics := m.Metrics()
+	assert.Equal(t, uint64(1), metrics.LockWaits)
+	assert.Greater(t, metrics.LockWaitTime, time.Duration(0))
+}
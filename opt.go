@@ -1,8 +1,36 @@
 package safemap
 
+import (
+	"fmt"
+	"math/bits"
+	"math/rand/v2"
+	"runtime"
+)
+
+const (
+	// buckets per expected concurrent goroutine with WithConcurrencyLevel
+	bucketsPerProc = 4
+	// max ratio of the fullest bucket to the average accepted by AutoBuckets
+	maxAutoBucketSkew = 1.5
+)
+
 type options[K comparable] struct {
 	bucketTotal int
 	hashFunc    func(K) uint64
+	shardFunc   func(hash uint64, bucketTotal int) int
+	hashSeed    uint64
+	seeded      bool
+	onSet       func(K)
+	onDelete    func(K)
+	loadFactor  int
+	metrics     *mapMetrics
+	lenCache    *lenCache
+	spinLock    bool
+	// valueCopier is the func(V) V of WithValueCopier; options has no
+	// value type parameter, so NewMap checks it against V
+	valueCopier any
+	// err is the first configuration error, returned by loadOpts
+	err error
 }
 
 type OptFunc[K comparable] func(*options[K])
@@ -18,6 +46,74 @@ func WithBuckets[K comparable](mask uint8) OptFunc[K] {
 	}
 }
 
+// WithBucketsE is WithBuckets without clamping: a mask above the max
+// makes NewMap return an error wrapping ErrInvalidBuckets. Use it with
+// constructors that return an error, such as NewMap and FromMap; the
+// others, like NewStringMap, panic with that error on an invalid mask.
+func WithBucketsE[K comparable](mask uint8) OptFunc[K] {
+	return func(o *options[K]) {
+		if mask > maxBucketMask {
+			if o.err == nil {
+				o.err = fmt.Errorf("%w: %d exceeds the max of %d (%d buckets)", ErrInvalidBuckets, mask, maxBucketMask, maxBucketCount)
+			}
+			return
+		}
+		o.bucketTotal = 1 << mask
+	}
+}
+
+// AutoBuckets recommends a WithBuckets mask from how hashFunc distributes
+// a sample of real keys: the largest mask, up to the max, for which the
+// fullest bucket holds at most maxAutoBucketSkew times the average. Keys
+// whose hashes cluster in the low bits get few buckets, since more would
+// stay empty, and larger samples support more buckets. An empty sample
+// returns the default mask.
+func AutoBuckets[K comparable](sampleKeys []K, hashFunc func(K) uint64) uint8 {
+	if len(sampleKeys) == 0 {
+		return uint8(bits.Len(defaultBucketCount - 1))
+	}
+	hashes := make([]uint64, len(sampleKeys))
+	for i, key := range sampleKeys {
+		hashes[i] = hashFunc(key)
+	}
+
+	counts := make([]int, maxBucketCount)
+	best := uint8(0)
+	for mask := uint8(1); mask <= maxBucketMask; mask++ {
+		n := 1 << mask
+		clear(counts[:n])
+		largest := 0
+		for _, h := range hashes {
+			i := h & uint64(n-1)
+			counts[i]++
+			largest = max(largest, counts[i])
+		}
+		if float64(largest) <= maxAutoBucketSkew*float64(len(hashes))/float64(n) {
+			best = mask
+		}
+	}
+	return best
+}
+
+// WithConcurrencyLevel sets safemap buckets capacity from the number of
+// goroutines expected to access the map concurrently: the smallest power of
+// two of at least bucketsPerProc buckets per goroutine, up to the max.
+// A procs <= 0 means runtime.GOMAXPROCS(0).
+func WithConcurrencyLevel[K comparable](procs int) OptFunc[K] {
+	return func(o *options[K]) {
+		n := procs
+		if n <= 0 {
+			n = runtime.GOMAXPROCS(0)
+		}
+		n *= bucketsPerProc
+		if n >= maxBucketCount {
+			o.bucketTotal = maxBucketCount
+		} else {
+			o.bucketTotal = 1 << bits.Len(uint(n-1))
+		}
+	}
+}
+
 // WithHashFunc sets hash function for key.
 func WithHashFunc[K comparable](fn func(K) uint64) OptFunc[K] {
 	return func(o *options[K]) {
@@ -25,11 +121,122 @@ func WithHashFunc[K comparable](fn func(K) uint64) OptFunc[K] {
 	}
 }
 
+// WithShardFunc sets how a key hash selects a bucket, in place of masking
+// the hash with bucketTotal-1. fn must return an index in [0, bucketTotal);
+// bucketTotal is always a power of two, and changes when the map grows.
+func WithShardFunc[K comparable](fn func(hash uint64, bucketTotal int) int) OptFunc[K] {
+	return func(o *options[K]) {
+		o.shardFunc = fn
+	}
+}
+
+// WithHashSeed mixes seed into every key hash.
+// Maps built with different seeds shard the same keys differently, which
+// makes bucket placement unpredictable for keys from untrusted input.
+func WithHashSeed[K comparable](seed uint64) OptFunc[K] {
+	return func(o *options[K]) {
+		o.hashSeed = seed
+		o.seeded = true
+	}
+}
+
+// WithRandomHashSeed is WithHashSeed with a randomly chosen seed.
+func WithRandomHashSeed[K comparable]() OptFunc[K] {
+	return WithHashSeed[K](rand.Uint64())
+}
+
+// WithOnSet sets a callback invoked with the key after each write that
+// stores a value. It runs after the bucket lock is released, so it may call
+// back into the map.
+func WithOnSet[K comparable](fn func(key K)) OptFunc[K] {
+	return func(o *options[K]) {
+		o.onSet = fn
+	}
+}
+
+// WithOnDelete sets a callback invoked with the key after each removal of
+// an existing entry. It runs after the bucket lock is released, so it may
+// call back into the map.
+func WithOnDelete[K comparable](fn func(key K)) OptFunc[K] {
+	return func(o *options[K]) {
+		o.onDelete = fn
+	}
+}
+
+// WithLoadFactor makes the map grow its bucket count, up to the maximum,
+// whenever the average number of entries per bucket exceeds maxAvg.
+// Growth rehashes every entry while all buckets are locked, and doubles the
+// bucket count until the average drops to maxAvg/2, so the map has to take
+// in as many entries again before it grows next. The map never shrinks.
+func WithLoadFactor[K comparable](maxAvg int) OptFunc[K] {
+	return func(o *options[K]) {
+		o.loadFactor = maxAvg
+	}
+}
+
+// WithMetrics makes the map record operation counters and bucket lock waits,
+// reported by Metrics. The counters are atomics shared by all buckets, so
+// they add some contention of their own; leave them off unless profiling.
+func WithMetrics[K comparable]() OptFunc[K] {
+	return func(o *options[K]) {
+		o.metrics = &mapMetrics{}
+	}
+}
+
+// WithApproxLen makes ApproxLen serve a cached entry count, refreshed
+// when a call finds it older than 100ms, for monitoring that polls the
+// length often. Len stays exact.
+func WithApproxLen[K comparable]() OptFunc[K] {
+	return func(o *options[K]) {
+		o.lenCache = &lenCache{}
+	}
+}
+
+// WithSpinLock makes each bucket use a spinning reader-writer lock built on
+// sync/atomic instead of sync.RWMutex. Waiters yield with runtime.Gosched
+// rather than parking, which is cheaper when critical sections are very
+// short, and wastes CPU when they are not; readers give way to waiting
+// writers. Callbacks that run under bucket locks, like those of Range or
+// LoadAndUpdate, should stay short.
+func WithSpinLock[K comparable]() OptFunc[K] {
+	return func(o *options[K]) {
+		o.spinLock = true
+	}
+}
+
+// WithValueCopier makes read paths hand out fn(stored) instead of the
+// stored value: Get, GetOrDefault, TryGet, GetWithLock, GetMultiple, ToMap,
+// Range, RangeSnapshot, RangeContext, RangeBucket, RangeWithBucket, Stream,
+// Count, MaxBy, MinBy, Transform, the view passed to Transact's fn, values
+// loaded by GetOrSet, GetOrSetActual and GetOrSetWithExpiry, the values
+// Merge reads from its source, and Get of the Unsafe view. Each reader gets
+// its own copy of a mutable value, such as a struct holding maps or slices,
+// and cannot change the stored one. fn runs under the bucket lock, so every
+// read pays for a deep copy and holds the lock for it.
+//
+// Stored values are not copied, and neither are values seen by writes or
+// comparisons: the value the GetOrSet family returns after storing it, those
+// returned by GetAndSet, SetAndReport or GetAndDelete, the values passed to
+// LoadAndUpdate, CompareAndSwapFunc, RangeUpdate, DeleteIf, TakeIf and
+// Equal, and the entries removed by TakeIf and DrainStream.
+//
+// V must be the map's value type; NewMap and Reset return an error
+// wrapping ErrValueCopierType otherwise, and constructors without an error
+// result, like NewStringMap, panic with it.
+func WithValueCopier[K comparable, V any](fn func(V) V) OptFunc[K] {
+	return func(o *options[K]) {
+		o.valueCopier = fn
+	}
+}
+
 func loadOpts[K comparable](opts ...OptFunc[K]) (*options[K], error) {
 	opt := &options[K]{}
 	for i := range opts {
 		opts[i](opt)
 	}
+	if opt.err != nil {
+		return nil, opt.err
+	}
 
 	if opt.bucketTotal == 0 {
 		opt.bucketTotal = defaultBucketCount
@@ -40,6 +247,10 @@ func loadOpts[K comparable](opts ...OptFunc[K]) (*options[K], error) {
 	if opt.hashFunc == nil {
 		return nil, ErrMissingHashFunc
 	}
+	if opt.seeded {
+		hashFunc, seed := opt.hashFunc, opt.hashSeed
+		opt.hashFunc = func(k K) uint64 { return hashWithSeed(hashFunc(k), seed) }
+	}
 
 	return opt, nil
 }
@@ -49,3 +260,17 @@ func HashStrKeyFunc() OptFunc[string] {
 		o.hashFunc = Hashstr
 	}
 }
+
+// HashFNVKeyFunc sets the FNV-1a hash function for string keys
+func HashFNVKeyFunc() OptFunc[string] {
+	return func(o *options[string]) {
+		o.hashFunc = HashFNV
+	}
+}
+
+// HashMaphashKeyFunc sets the hash/maphash hash function for string keys
+func HashMaphashKeyFunc() OptFunc[string] {
+	return func(o *options[string]) {
+		o.hashFunc = HashMaphash
+	}
+}
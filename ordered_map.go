@@ -0,0 +1,128 @@
+package safemap
+
+import (
+	"container/list"
+	"sync"
+)
+
+// orderedValue is a value of an OrderedSafeMap with its place in the order
+type orderedValue[V any] struct {
+	val  V
+	elem *list.Element
+}
+
+// OrderedSafeMap is a SafeMap that also remembers the order in which keys
+// were first inserted, and ranges over entries oldest first.
+//
+// Entries are sharded into buckets like in SafeMap, so Get and Contains
+// take only a bucket lock. The insertion order is a list of keys guarded
+// by a single mutex, which inserts and deletes of new keys take briefly
+// while they hold their bucket lock. Overwriting an existing key keeps its
+// position.
+//
+// The order costs a list element per entry: a copy of the key plus three
+// pointers, and one more pointer stored with each value.
+type OrderedSafeMap[K comparable, V any] struct {
+	m     *SafeMap[K, orderedValue[V]]
+	mu    sync.Mutex
+	order *list.List
+}
+
+// NewOrderedMap creates a new insertion-ordered map.
+// It takes the same options as NewMap and, like NewMap, returns
+// ErrMissingHashFunc if no hash function is set.
+func NewOrderedMap[K comparable, V any](options ...OptFunc[K]) (*OrderedSafeMap[K, V], error) {
+	m, err := NewMap[K, orderedValue[V]](options...)
+	if err != nil {
+		return nil, err
+	}
+	return &OrderedSafeMap[K, V]{m: m, order: list.New()}, nil
+}
+
+// Get returns key's value
+func (o *OrderedSafeMap[K, V]) Get(key K) (V, bool) {
+	ov, b := o.m.Get(key)
+	return ov.val, b
+}
+
+// Contains reports whether key is present
+func (o *OrderedSafeMap[K, V]) Contains(key K) bool {
+	return o.m.Contains(key)
+}
+
+// Set sets key's value. A new key is placed last in the order; an existing
+// key keeps its position.
+func (o *OrderedSafeMap[K, V]) Set(key K, val V) {
+	bucket, t := o.m.lockKey(key)
+	t.metrics.addSet()
+	ov, b := bucket.innerMap[key]
+	if !b {
+		o.mu.Lock()
+		ov.elem = o.order.PushBack(key)
+		o.mu.Unlock()
+		bucket.count++
+	}
+	ov.val = val
+	bucket.innerMap[key] = ov
+	grow := t.overloaded(bucket)
+	bucket.Unlock()
+	t.notifySet(key)
+	if grow {
+		o.m.grow(t)
+	}
+}
+
+// Delete removes key and its place in the order
+func (o *OrderedSafeMap[K, V]) Delete(key K) {
+	bucket, t := o.m.lockKey(key)
+	t.metrics.addDelete()
+	ov, b := bucket.innerMap[key]
+	if !b {
+		bucket.Unlock()
+		return
+	}
+	delete(bucket.innerMap, key)
+	bucket.count--
+	o.mu.Lock()
+	o.order.Remove(ov.elem)
+	o.mu.Unlock()
+	bucket.Unlock()
+	t.notifyDelete(key)
+}
+
+// Len returns map items total
+func (o *OrderedSafeMap[K, V]) Len() int {
+	return o.m.Len()
+}
+
+// Range calls f for each key and value present in the map, oldest first.
+// It is the same as RangeOrdered.
+func (o *OrderedSafeMap[K, V]) Range(f func(k K, v V) bool) {
+	o.RangeOrdered(f)
+}
+
+// RangeOrdered calls f for each key and value present in the map, in
+// insertion order. If f returns false, the iteration stops.
+//
+// The order is snapshotted under the order mutex, then each value is
+// re-read right before f is called; keys deleted in the meantime are
+// skipped. No lock is held while f runs, so f may call other methods of
+// the map.
+func (o *OrderedSafeMap[K, V]) RangeOrdered(f func(k K, v V) bool) {
+	o.mu.Lock()
+	keys := make([]K, 0, o.order.Len())
+	for e := o.order.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(K))
+	}
+	o.mu.Unlock()
+
+	for _, key := range keys {
+		val, b := o.Get(key)
+		if !b {
+			continue
+		}
+		if !f(key, val) {
+			return
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package safemap
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func orderedKeys[K comparable, V any](o *OrderedSafeMap[K, V]) []K {
+	var keys []K
+	o.RangeOrdered(func(k K, v V) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+func TestOrderedMap(t *testing.T) {
+	_, err := NewOrderedMap[string, int]()
+	assert.ErrorIs(t, err, ErrMissingHashFunc)
+
+	o, err := NewOrderedMap[string, int](HashStrKeyFunc())
+	assert.Nil(t, err)
+	for _, key := range []string{"c", "a", "d", "b"} {
+		o.Set(key, len(key))
+	}
+	assert.Equal(t, []string{"c", "a", "d", "b"}, orderedKeys(o))
+
+	// overwriting keeps the position
+	o.Set("a", 10)
+	val, ok := o.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 10, val)
+	assert.Equal(t, []string{"c", "a", "d", "b"}, orderedKeys(o))
+
+	// deleting removes the position; re-adding places the key last
+	o.Delete("c")
+	o.Delete("x")
+	assert.False(t, o.Contains("c"))
+	assert.Equal(t, []string{"a", "d", "b"}, orderedKeys(o))
+	o.Set("c", 1)
+	assert.Equal(t, []string{"a", "d", "b", "c"}, orderedKeys(o))
+	assert.Equal(t, 4, o.Len())
+
+	var vals []int
+	o.Range(func(k string, v int) bool {
+		vals = append(vals, v)
+		return len(vals) < 2
+	})
+	assert.Equal(t, []int{10, 1}, vals)
+}
+
+func TestOrderedMapGrow(t *testing.T) {
+	o, _ := NewOrderedMap[int, int](WithHashFunc(func(k int) uint64 { return uint64(k) }),
+		WithBuckets[int](0), WithLoadFactor[int](4))
+	want := make([]int, 0, 1000)
+	for i := 999; i >= 0; i-- {
+		o.Set(i, i)
+		want = append(want, i)
+	}
+	assert.Greater(t, o.m.BucketCount(), 1)
+	assert.Equal(t, want, orderedKeys(o))
+}
+
+func TestOrderedMapConcurrent(t *testing.T) {
+	o, _ := NewOrderedMap[string, int](HashStrKeyFunc())
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := strconv.Itoa(i % 100)
+				o.Set(key, i)
+				if i%3 == 0 {
+					o.Delete(key)
+				}
+				o.Range(func(k string, v int) bool { return true })
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the order tracks exactly the keys present
+	keys := orderedKeys(o)
+	assert.Equal(t, o.Len(), len(keys))
+	assert.Equal(t, o.Len(), o.order.Len())
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		assert.False(t, seen[key], key)
+		seen[key] = true
+	}
+}
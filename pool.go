@@ -0,0 +1,41 @@
+package safemap
+
+import "sync"
+
+// Pool is a set of reusable SafeMaps sharing one configuration, backed by
+// sync.Pool. It suits maps that live for a single request or task, whose
+// buckets would otherwise be reallocated and collected every time.
+type Pool[K comparable, V any] struct {
+	pool sync.Pool
+}
+
+// NewPool returns a Pool of maps created with options.
+// Like NewMap, it returns ErrMissingHashFunc if no hash function is set.
+func NewPool[K comparable, V any](options ...OptFunc[K]) (*Pool[K, V], error) {
+	opt, err := loadOpts(options...)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkValueCopier[K, V](opt); err != nil {
+		return nil, err
+	}
+	p := &Pool[K, V]{}
+	p.pool.New = func() any {
+		m, _ := NewMap[K, V](options...)
+		return m
+	}
+	return p, nil
+}
+
+// Get returns an empty map from the pool, creating one if none is available
+func (p *Pool[K, V]) Get() *SafeMap[K, V] {
+	return p.pool.Get().(*SafeMap[K, V])
+}
+
+// Put clears m and returns it to the pool. Clearing works like Clear, so
+// the buckets keep their storage and an OnDelete observer is called for
+// each removed key. m must not be used after Put.
+func (p *Pool[K, V]) Put(m *SafeMap[K, V]) {
+	m.Clear()
+	p.pool.Put(m)
+}
@@ -0,0 +1,33 @@
+package safemap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	_, err := NewPool[string, int]()
+	assert.ErrorIs(t, err, ErrMissingHashFunc)
+
+	p, err := NewPool[string, int](HashStrKeyFunc(), WithBuckets[string](3))
+	assert.Nil(t, err)
+
+	m := p.Get()
+	assert.True(t, m.IsEmpty())
+	assert.Equal(t, 8, m.BucketCount())
+	for i := 0; i < 100; i++ {
+		m.Set(string(rune('a'+i%26))+string(rune('a'+i/26)), i)
+	}
+	assert.Equal(t, 100, m.Len())
+	p.Put(m)
+
+	m = p.Get()
+	assert.True(t, m.IsEmpty())
+	assert.Equal(t, 8, m.BucketCount())
+	_, ok := m.Get("aa")
+	assert.False(t, ok)
+	m.Set("a", 1)
+	assert.Equal(t, 1, m.Len())
+	p.Put(m)
+}
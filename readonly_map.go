@@ -0,0 +1,35 @@
+package safemap
+
+// ReadOnlyMap is a read-only view of a SafeMap.
+// It exposes no methods that modify the map. The view is backed by the
+// live map rather than a copy: writes made through the SafeMap itself are
+// visible through the view, and reads take the same bucket locks.
+type ReadOnlyMap[K comparable, V any] struct {
+	m *SafeMap[K, V]
+}
+
+// Freeze returns a read-only view of the map
+func (m *SafeMap[K, V]) Freeze() ReadOnlyMap[K, V] {
+	return ReadOnlyMap[K, V]{m: m}
+}
+
+// Get returns key's value
+func (r ReadOnlyMap[K, V]) Get(key K) (V, bool) {
+	return r.m.Get(key)
+}
+
+// Contains reports whether key is present
+func (r ReadOnlyMap[K, V]) Contains(key K) bool {
+	return r.m.Contains(key)
+}
+
+// Len returns map items total
+func (r ReadOnlyMap[K, V]) Len() int {
+	return r.m.Len()
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, the iteration stops.
+func (r ReadOnlyMap[K, V]) Range(f func(k K, v V) bool) {
+	r.m.Range(f)
+}
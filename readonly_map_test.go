@@ -0,0 +1,43 @@
+package safemap
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFreeze(t *testing.T) {
+	m := NewStringMap[string, int]()
+	m.Set("a", 1)
+	m.Set("b", 2)
+
+	r := m.Freeze()
+	assert.Equal(t, 2, r.Len())
+	val, ok := r.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, val)
+	_, ok = r.Get("c")
+	assert.False(t, ok)
+	assert.True(t, r.Contains("b"))
+	assert.False(t, r.Contains("c"))
+
+	visited := make(map[string]int)
+	r.Range(func(k string, v int) bool {
+		visited[k] = v
+		return true
+	})
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, visited)
+
+	// the view follows the live map
+	m.Set("c", 3)
+	assert.True(t, r.Contains("c"))
+	assert.Equal(t, 3, r.Len())
+
+	// no mutating methods are exposed
+	typ := reflect.TypeOf(r)
+	for _, name := range []string{"Set", "Delete", "GetAndDelete", "GetOrSet", "Clear"} {
+		_, ok := typ.MethodByName(name)
+		assert.False(t, ok, name)
+	}
+}
@@ -16,6 +16,26 @@ func (l *RwMap[T, V]) Get(key T) (V, bool) {
 	return val, b
 }
 
+// GetOrDefault returns the value for the key if present, and def otherwise.
+// It never modifies the map.
+func (l *RwMap[T, V]) GetOrDefault(key T, def V) V {
+	l.mu.RLock()
+	val, b := l.m[key]
+	l.mu.RUnlock()
+	if !b {
+		return def
+	}
+	return val
+}
+
+// Contains reports whether the key is present, without copying its value.
+func (l *RwMap[T, V]) Contains(key T) bool {
+	l.mu.RLock()
+	_, b := l.m[key]
+	l.mu.RUnlock()
+	return b
+}
+
 // Set stores the given value for the specified key in the map.
 // If the key already exists, its value will be overwritten.
 // The operation is protected by a write lock to ensure thread safety.
@@ -25,6 +45,17 @@ func (l *RwMap[T, V]) Set(key T, val V) {
 	l.mu.Unlock()
 }
 
+// SetAndReport stores the given value for the specified key and returns the
+// previous value and whether the key existed. Unlike GetOrSet, it always writes.
+// The operation is protected by a write lock to ensure thread safety.
+func (l *RwMap[T, V]) SetAndReport(key T, val V) (previous V, existed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	previous, existed = l.m[key]
+	l.m[key] = val
+	return previous, existed
+}
+
 // Delete removes the key-value pair from the map.
 // The operation is protected by a write lock to ensure thread safety.
 func (l *RwMap[T, V]) Delete(key T) {
@@ -60,6 +91,54 @@ func (l *RwMap[T, V]) GetOrSet(key T, val V) (V, bool) {
 	return val, false
 }
 
+// GetOrSetFunc returns the existing value for the key if present.
+// Otherwise, it stores and returns the value returned by fn, which is
+// called at most once. The loaded result is true if the value was loaded.
+// fn runs under the write lock and must not call other methods of the map.
+func (l *RwMap[T, V]) GetOrSetFunc(key T, fn func() V) (V, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if val, b := l.m[key]; b {
+		return val, true
+	}
+	val := fn()
+	l.m[key] = val
+	return val, false
+}
+
+// Compute replaces the key's value with the result of fn, or deletes the key
+// if fn returns false as its second result. fn receives the current value and
+// whether the key exists. It returns the new value and whether the key is
+// present afterwards.
+// fn runs under the write lock, so the read-modify-write is atomic; fn must
+// not call other methods of the map.
+func (l *RwMap[T, V]) Compute(key T, fn func(old V, exists bool) (V, bool)) (V, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	old, b := l.m[key]
+	val, keep := fn(old, b)
+	if !keep {
+		delete(l.m, key)
+		var zero V
+		return zero, false
+	}
+	l.m[key] = val
+	return val, true
+}
+
+// CompareAndSwapFunc stores new for the key if the key is present and eq
+// reports its current value equal to old. It returns whether the swap happened.
+// The operation is protected by a write lock, so values need not be comparable.
+func (l *RwMap[T, V]) CompareAndSwapFunc(key T, old, new V, eq func(a, b V) bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cur, b := l.m[key]; !b || !eq(cur, old) {
+		return false
+	}
+	l.m[key] = new
+	return true
+}
+
 // Len returns the number of key-value pairs in the map.
 // The operation is protected by a read lock to ensure thread safety.
 func (l *RwMap[T, V]) Len() int {
@@ -80,6 +159,30 @@ func (l *RwMap[T, V]) Range(f func(key T, val V) bool) {
 	}
 }
 
+// Keys returns the keys present in the map, in no particular order.
+// The operation is protected by a read lock to ensure thread safety.
+func (l *RwMap[T, V]) Keys() []T {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	keys := make([]T, 0, len(l.m))
+	for key := range l.m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// ToMap returns a copy of the map's entries as a native map.
+// The operation is protected by a read lock to ensure thread safety.
+func (l *RwMap[T, V]) ToMap() map[T]V {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	res := make(map[T]V, len(l.m))
+	for key, val := range l.m {
+		res[key] = val
+	}
+	return res
+}
+
 // NewRwMap returns a new initialized RwMap.
 func NewRwMap[T comparable, V any]() *RwMap[T, V] {
 	return &RwMap[T, V]{
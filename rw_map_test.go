@@ -1,7 +1,10 @@
 package safemap
 
 import (
+	"reflect"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -20,6 +23,42 @@ func TestRwMap_Get(t *testing.T) {
 	}
 }
 
+func TestRwMap_Contains(t *testing.T) {
+	lock := NewRwMap[string, int]()
+	lock.Set("foo", 42)
+
+	if !lock.Contains("foo") {
+		t.Errorf("Contains() = %v, want %v", false, true)
+	}
+	if lock.Contains("bar") {
+		t.Errorf("Contains() = %v, want %v", true, false)
+	}
+
+	lock.Delete("foo")
+	if lock.Contains("foo") {
+		t.Errorf("Contains() after Delete() = %v, want %v", true, false)
+	}
+}
+
+func TestRwMap_GetOrDefault(t *testing.T) {
+	lock := NewRwMap[string, int]()
+	lock.Set("foo", 42)
+	lock.Set("zero", 0)
+
+	if val := lock.GetOrDefault("foo", -1); val != 42 {
+		t.Errorf("GetOrDefault() = %v, want %v", val, 42)
+	}
+	if val := lock.GetOrDefault("bar", -1); val != -1 {
+		t.Errorf("GetOrDefault() = %v, want %v", val, -1)
+	}
+	if val := lock.GetOrDefault("zero", -1); val != 0 {
+		t.Errorf("GetOrDefault() = %v, want %v", val, 0)
+	}
+	if lock.Len() != 2 {
+		t.Errorf("GetOrDefault() modified the map, Len() = %v, want %v", lock.Len(), 2)
+	}
+}
+
 func TestRwMap_Set(t *testing.T) {
 	lock := NewRwMap[string, int]()
 	lock.Set("foo", 42)
@@ -37,6 +76,27 @@ func TestRwMap_Set(t *testing.T) {
 	}
 }
 
+func TestRwMap_SetAndReport(t *testing.T) {
+	lock := NewRwMap[string, int]()
+
+	prev, existed := lock.SetAndReport("foo", 42)
+	if existed || prev != 0 {
+		t.Errorf("SetAndReport() = %v, %v, want %v, %v", prev, existed, 0, false)
+	}
+
+	prev, existed = lock.SetAndReport("foo", 100)
+	if !existed || prev != 42 {
+		t.Errorf("SetAndReport() = %v, %v, want %v, %v", prev, existed, 42, true)
+	}
+
+	if val, _ := lock.Get("foo"); val != 100 {
+		t.Errorf("Get() after SetAndReport() = %v, want %v", val, 100)
+	}
+	if lock.Len() != 1 {
+		t.Errorf("Len() = %v, want %v", lock.Len(), 1)
+	}
+}
+
 func TestRwMap_Delete(t *testing.T) {
 	lock := NewRwMap[string, int]()
 	lock.Set("foo", 42)
@@ -88,6 +148,105 @@ func TestRwMap_GetOrSet(t *testing.T) {
 	}
 }
 
+func TestRwMap_GetOrSetFunc(t *testing.T) {
+	lock := NewRwMap[string, int]()
+
+	var calls atomic.Int32
+	fn := func() int {
+		calls.Add(1)
+		return 42
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if val, _ := lock.GetOrSetFunc("foo", fn); val != 42 {
+				t.Errorf("GetOrSetFunc() = %v, want %v", val, 42)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("GetOrSetFunc() called fn %v times, want %v", n, 1)
+	}
+
+	val, loaded := lock.GetOrSetFunc("foo", func() int {
+		t.Errorf("GetOrSetFunc() called fn for a present key")
+		return 0
+	})
+	if !loaded || val != 42 {
+		t.Errorf("GetOrSetFunc() = %v, %v, want %v, %v", val, loaded, 42, true)
+	}
+}
+
+func TestRwMap_Compute(t *testing.T) {
+	lock := NewRwMap[string, int]()
+	incr := func(old int, exists bool) (int, bool) { return old + 1, true }
+
+	// insert
+	val, ok := lock.Compute("foo", func(old int, exists bool) (int, bool) {
+		if exists {
+			t.Errorf("Compute() exists = %v, want %v", exists, false)
+		}
+		return 1, true
+	})
+	if !ok || val != 1 {
+		t.Errorf("Compute() = %v, %v, want %v, %v", val, ok, 1, true)
+	}
+
+	// update, atomically across goroutines
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock.Compute("foo", incr)
+		}()
+	}
+	wg.Wait()
+	if val, _ := lock.Get("foo"); val != 101 {
+		t.Errorf("Get() after Compute() = %v, want %v", val, 101)
+	}
+
+	// delete
+	val, ok = lock.Compute("foo", func(old int, exists bool) (int, bool) { return 0, false })
+	if ok || val != 0 {
+		t.Errorf("Compute() = %v, %v, want %v, %v", val, ok, 0, false)
+	}
+	if lock.Contains("foo") {
+		t.Errorf("Contains() after deleting Compute() = %v, want %v", true, false)
+	}
+
+	// declining to insert leaves the key absent
+	lock.Compute("bar", func(old int, exists bool) (int, bool) { return 0, false })
+	if lock.Len() != 0 {
+		t.Errorf("Len() = %v, want %v", lock.Len(), 0)
+	}
+}
+
+func TestRwMap_CompareAndSwapFunc(t *testing.T) {
+	lock := NewRwMap[string, []int]()
+	lock.Set("foo", []int{1, 2})
+	eq := func(a, b []int) bool { return reflect.DeepEqual(a, b) }
+
+	if lock.CompareAndSwapFunc("foo", []int{1}, []int{3}, eq) {
+		t.Errorf("CompareAndSwapFunc() with a mismatched old = %v, want %v", true, false)
+	}
+	if !lock.CompareAndSwapFunc("foo", []int{1, 2}, []int{3}, eq) {
+		t.Errorf("CompareAndSwapFunc() = %v, want %v", false, true)
+	}
+	if val, _ := lock.Get("foo"); !eq(val, []int{3}) {
+		t.Errorf("Get() after CompareAndSwapFunc() = %v, want %v", val, []int{3})
+	}
+	if lock.CompareAndSwapFunc("bar", nil, []int{1}, eq) {
+		t.Errorf("CompareAndSwapFunc() on a missing key = %v, want %v", true, false)
+	}
+	if lock.Contains("bar") {
+		t.Errorf("Contains() after a failed CompareAndSwapFunc() = %v, want %v", true, false)
+	}
+}
+
 func TestRwMap_Len(t *testing.T) {
 	lock := NewRwMap[string, int]()
 	if lock.Len() != 0 {
@@ -132,6 +291,41 @@ func TestRwMap_Range(t *testing.T) {
 	}
 }
 
+func TestRwMap_KeysAndToMap(t *testing.T) {
+	lock := NewRwMap[string, int]()
+	if keys := lock.Keys(); len(keys) != 0 {
+		t.Errorf("Keys() on an empty map = %v, want none", keys)
+	}
+	if res := lock.ToMap(); res == nil || len(res) != 0 {
+		t.Errorf("ToMap() on an empty map = %v, want an empty map", res)
+	}
+
+	lock.Set("foo", 42)
+	lock.Set("bar", 100)
+
+	keys := lock.Keys()
+	sort.Strings(keys)
+	if want := []string{"bar", "foo"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Keys() = %v, want %v", keys, want)
+	}
+	want := map[string]int{"foo": 42, "bar": 100}
+	if res := lock.ToMap(); !reflect.DeepEqual(res, want) {
+		t.Errorf("ToMap() = %v, want %v", res, want)
+	}
+
+	// the snapshots are independent of the map
+	res := lock.ToMap()
+	res["baz"] = 1
+	keys[0] = "baz"
+	if lock.Contains("baz") {
+		t.Errorf("Contains() after modifying the snapshots = %v, want %v", true, false)
+	}
+	lock.Delete("foo")
+	if _, ok := res["foo"]; !ok {
+		t.Errorf("ToMap() copy lost %q after Delete()", "foo")
+	}
+}
+
 func TestRwMap_Concurrent(t *testing.T) {
 	lock := NewRwMap[string, int]()
 	var wg sync.WaitGroup
@@ -0,0 +1,81 @@
+package safemap
+
+// SafeSet is a thread-safe set of comparable elements, sharded into
+// buckets like SafeMap.
+type SafeSet[K comparable] struct {
+	m       *SafeMap[K, struct{}]
+	options []OptFunc[K]
+}
+
+// NewSet creates a new set.
+// It takes the same options as NewMap and, like NewMap, returns
+// ErrMissingHashFunc if no hash function is set.
+func NewSet[K comparable](options ...OptFunc[K]) (*SafeSet[K], error) {
+	m, err := NewMap[K, struct{}](options...)
+	if err != nil {
+		return nil, err
+	}
+	return &SafeSet[K]{m: m, options: options}, nil
+}
+
+// Add adds key, reporting whether it was not already present
+func (s *SafeSet[K]) Add(key K) bool {
+	_, loaded := s.m.GetOrSet(key, struct{}{})
+	return !loaded
+}
+
+// Remove removes key, reporting whether it was present
+func (s *SafeSet[K]) Remove(key K) bool {
+	_, loaded := s.m.GetAndDelete(key)
+	return loaded
+}
+
+// Contains reports whether key is present
+func (s *SafeSet[K]) Contains(key K) bool {
+	return s.m.Contains(key)
+}
+
+// Len returns the number of elements
+func (s *SafeSet[K]) Len() int {
+	return s.m.Len()
+}
+
+// Range calls f sequentially for each element, holding every bucket lock
+// like SafeMap.Range. If f returns false, the iteration stops.
+func (s *SafeSet[K]) Range(f func(key K) bool) {
+	s.m.Range(func(k K, _ struct{}) bool { return f(k) })
+}
+
+// Union returns a new set, created with s's options, holding the elements
+// of s and other. Each set is read on its own, so the result is not a
+// consistent snapshot of both while they are modified.
+func (s *SafeSet[K]) Union(other *SafeSet[K]) *SafeSet[K] {
+	res := s.withKeys(s.m.keys())
+	for _, key := range other.m.keys() {
+		res.m.Set(key, struct{}{})
+	}
+	return res
+}
+
+// Intersect returns a new set, created with s's options, holding the
+// elements present in both s and other. Both sets are read-locked for the
+// comparison like in IntersectionKeys.
+func (s *SafeSet[K]) Intersect(other *SafeSet[K]) *SafeSet[K] {
+	return s.withKeys(IntersectionKeys(s.m, other.m))
+}
+
+// Difference returns a new set, created with s's options, holding the
+// elements of s not present in other. Both sets are read-locked for the
+// comparison like in DifferenceKeys.
+func (s *SafeSet[K]) Difference(other *SafeSet[K]) *SafeSet[K] {
+	return s.withKeys(DifferenceKeys(s.m, other.m))
+}
+
+// withKeys returns a new set created with s's options holding keys
+func (s *SafeSet[K]) withKeys(keys []K) *SafeSet[K] {
+	res, _ := NewSet[K](s.options...)
+	for _, key := range keys {
+		res.m.Set(key, struct{}{})
+	}
+	return res
+}
@@ -0,0 +1,92 @@
+package safemap
+
+import (
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newIntSet(t *testing.T, keys ...int) *SafeSet[int] {
+	s, err := NewSet[int](WithHashFunc(func(k int) uint64 { return uint64(k) }))
+	assert.Nil(t, err)
+	for _, key := range keys {
+		s.Add(key)
+	}
+	return s
+}
+
+func setKeys(s *SafeSet[int]) []int {
+	var keys []int
+	s.Range(func(key int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	sort.Ints(keys)
+	return keys
+}
+
+func TestSet(t *testing.T) {
+	_, err := NewSet[int]()
+	assert.ErrorIs(t, err, ErrMissingHashFunc)
+
+	s := newIntSet(t)
+	assert.True(t, s.Add(1))
+	assert.False(t, s.Add(1))
+	assert.True(t, s.Add(2))
+	assert.True(t, s.Contains(1))
+	assert.False(t, s.Contains(3))
+	assert.Equal(t, 2, s.Len())
+
+	assert.True(t, s.Remove(1))
+	assert.False(t, s.Remove(1))
+	assert.False(t, s.Contains(1))
+	assert.Equal(t, []int{2}, setKeys(s))
+}
+
+func TestSetAlgebra(t *testing.T) {
+	a := newIntSet(t, 1, 2, 3, 4)
+	b := newIntSet(t, 3, 4, 5)
+
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, setKeys(a.Union(b)))
+	assert.Equal(t, []int{3, 4}, setKeys(a.Intersect(b)))
+	assert.Equal(t, []int{1, 2}, setKeys(a.Difference(b)))
+	assert.Equal(t, []int{5}, setKeys(b.Difference(a)))
+
+	// a set with itself
+	assert.Equal(t, []int{1, 2, 3, 4}, setKeys(a.Union(a)))
+	assert.Equal(t, []int{1, 2, 3, 4}, setKeys(a.Intersect(a)))
+	assert.Equal(t, 0, a.Difference(a).Len())
+
+	// results are independent of their operands
+	u := a.Union(b)
+	u.Add(6)
+	assert.False(t, a.Contains(6))
+	assert.False(t, b.Contains(6))
+}
+
+func TestSetConcurrent(t *testing.T) {
+	s := newIntSet(t)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				s.Add(i)
+				if i%2 == 1 {
+					s.Remove(i)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// every goroutine's last operation on an odd element is a Remove
+	for i := 0; i < 1000; i++ {
+		assert.Equal(t, i%2 == 0, s.Contains(i))
+	}
+	assert.Equal(t, 500, s.Len())
+}
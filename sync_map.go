@@ -27,11 +27,21 @@ func (m *SyncMap[K, V]) Len() int {
 func (m *SyncMap[K, V]) Get(key K) (value V, exists bool) {
 	_val, exists := m.p.Load(key)
 	if exists {
-		return _val.(V), true
+		return fromAny[V](_val), true
 	}
 	return value, false
 }
 
+// GetOrDefault returns key's value if present, and def otherwise.
+// It never modifies the map.
+func (m *SyncMap[K, V]) GetOrDefault(key K, def V) V {
+	_val, exists := m.p.Load(key)
+	if exists {
+		return fromAny[V](_val)
+	}
+	return def
+}
+
 // Set sets key's value, same as sync.Map.Store
 func (m *SyncMap[K, V]) Set(key K, value V) {
 	m.p.Store(key, value)
@@ -47,7 +57,7 @@ func (m *SyncMap[K, V]) Delete(key K) {
 func (m *SyncMap[K, V]) GetAndDelete(key K) (value V, loaded bool) {
 	_val, loaded := m.p.LoadAndDelete(key)
 	if loaded {
-		return _val.(V), true
+		return fromAny[V](_val), true
 	}
 	return value, false
 }
@@ -57,10 +67,33 @@ func (m *SyncMap[K, V]) GetAndDelete(key K) (value V, loaded bool) {
 // Same as sync.Map.Range
 func (m *SyncMap[K, V]) Range(f func(K, V) bool) {
 	m.p.Range(func(key, value any) bool {
-		return f(key.(K), value.(V))
+		return f(fromAny[K](key), fromAny[V](value))
 	})
 }
 
+// Keys returns the keys present in the map.
+// Like Range, it is a best-effort view, not a consistent snapshot:
+// keys stored or deleted concurrently may or may not be included.
+func (m *SyncMap[K, V]) Keys() []K {
+	var keys []K
+	m.Range(func(key K, _ V) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// ToMap returns a copy of the map's entries as a native map.
+// Like Range, it is a best-effort view, not a consistent snapshot.
+func (m *SyncMap[K, V]) ToMap() map[K]V {
+	res := make(map[K]V)
+	m.Range(func(key K, value V) bool {
+		res[key] = value
+		return true
+	})
+	return res
+}
+
 // GetOrSet returns the existing value for the key if present.
 // Otherwise, it stores and returns the given value.
 // The loaded result is true if the value was loaded, false if stored.
@@ -69,7 +102,7 @@ func (m *SyncMap[K, V]) Range(f func(K, V) bool) {
 func (m *SyncMap[K, V]) GetOrSet(key K, val V) (actual V, loaded bool) {
 	_val, loaded := m.p.LoadOrStore(key, val)
 	if loaded {
-		return _val.(V), true
+		return fromAny[V](_val), true
 	}
 	return val, false
 }
@@ -79,7 +112,7 @@ func (m *SyncMap[K, V]) GetOrSet(key K, val V) (actual V, loaded bool) {
 func (m *SyncMap[K, V]) Swap(key K, val V) (previous V, loaded bool) {
 	_val, loaded := m.p.Swap(key, val)
 	if loaded {
-		return _val.(V), true
+		return fromAny[V](_val), true
 	}
 	return previous, false
 }
@@ -101,6 +134,14 @@ func (m *SyncMap[K, V]) CompareAndSwap(key K, old, new V) bool {
 	return m.p.CompareAndSwap(key, old, new)
 }
 
+// fromAny converts a key or value loaded from the sync.Map back to T.
+// A nil interface, stored for an interface type T, becomes T's zero value
+// instead of failing the type assertion.
+func fromAny[T any](v any) T {
+	t, _ := v.(T)
+	return t
+}
+
 // NewSyncMap returns a new empty SyncMap
 func NewSyncMap[K comparable, V any]() *SyncMap[K, V] {
 	return &SyncMap[K, V]{}
@@ -1,6 +1,9 @@
 package safemap
 
 import (
+	"errors"
+	"reflect"
+	"sort"
 	"sync"
 	"testing"
 
@@ -81,6 +84,25 @@ func TestSyncMapGet(t *testing.T) {
 	}
 }
 
+func TestSyncMapGetOrDefault(t *testing.T) {
+	m := &SyncMap[string, int]{}
+	m.Set("key1", 42)
+	m.Set("zero", 0)
+
+	if val := m.GetOrDefault("key1", -1); val != 42 {
+		t.Errorf("Expected value 42, got %v", val)
+	}
+	if val := m.GetOrDefault("key2", -1); val != -1 {
+		t.Errorf("Expected default -1 for non-existent key, got %v", val)
+	}
+	if val := m.GetOrDefault("zero", -1); val != 0 {
+		t.Errorf("Expected stored zero value, got %v", val)
+	}
+	if m.Len() != 2 {
+		t.Errorf("Expected map to be unchanged, got %d items", m.Len())
+	}
+}
+
 func TestSyncMapSet(t *testing.T) {
 	m := &SyncMap[string, int]{}
 
@@ -183,6 +205,41 @@ func TestSyncMapRange(t *testing.T) {
 	}
 }
 
+func TestSyncMapKeysAndToMap(t *testing.T) {
+	m := &SyncMap[string, int]{}
+	if keys := m.Keys(); len(keys) != 0 {
+		t.Errorf("Keys() on an empty map = %v, want none", keys)
+	}
+	if res := m.ToMap(); res == nil || len(res) != 0 {
+		t.Errorf("ToMap() on an empty map = %v, want an empty map", res)
+	}
+
+	testData := map[string]int{
+		"key1": 10,
+		"key2": 20,
+		"key3": 30,
+	}
+	for k, v := range testData {
+		m.Set(k, v)
+	}
+
+	keys := m.Keys()
+	sort.Strings(keys)
+	if want := []string{"key1", "key2", "key3"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Keys() = %v, want %v", keys, want)
+	}
+	if res := m.ToMap(); !reflect.DeepEqual(res, testData) {
+		t.Errorf("ToMap() = %v, want %v", res, testData)
+	}
+
+	// the copy is independent of the map
+	res := m.ToMap()
+	res["key4"] = 40
+	if _, ok := m.Get("key4"); ok {
+		t.Errorf("ToMap() result shares storage with the map")
+	}
+}
+
 func TestSyncMapGetOrSet(t *testing.T) {
 	m := &SyncMap[string, int]{}
 
@@ -205,6 +262,24 @@ func TestSyncMapGetOrSet(t *testing.T) {
 	}
 }
 
+// On the store path GetOrSet must return the stored value, not the zero value.
+func TestSyncMapGetOrSetStoredValue(t *testing.T) {
+	m := &SyncMap[string, *int]{}
+	stored := new(int)
+	*stored = 7
+
+	actual, loaded := m.GetOrSet("fresh", stored)
+	if loaded {
+		t.Errorf("GetOrSet() on a fresh key loaded = %v, want %v", loaded, false)
+	}
+	if actual != stored {
+		t.Errorf("GetOrSet() on a fresh key = %v, want the stored %v", actual, stored)
+	}
+	if val, _ := m.Get("fresh"); val != stored {
+		t.Errorf("Get() after GetOrSet() = %v, want %v", val, stored)
+	}
+}
+
 func TestSyncMapSwap(t *testing.T) {
 	m := &SyncMap[string, int]{}
 
@@ -285,6 +360,77 @@ func TestSyncMapCompareAndSwap(t *testing.T) {
 	}
 }
 
+// Wrappers must return what sync.Map returns, including nil values stored
+// for an interface value type, without panicking on the type assertion.
+func TestSyncMapNilInterfaceValues(t *testing.T) {
+	m := &SyncMap[string, error]{}
+	errBoom := errors.New("boom")
+	m.Set("nil", nil)
+
+	if val, ok := m.Get("nil"); !ok || val != nil {
+		t.Errorf("Get() = %v, %v, want %v, %v", val, ok, nil, true)
+	}
+	if val := m.GetOrDefault("nil", errBoom); val != nil {
+		t.Errorf("GetOrDefault() = %v, want %v", val, nil)
+	}
+	if val := m.GetOrDefault("missing", errBoom); val != errBoom {
+		t.Errorf("GetOrDefault() on a missing key = %v, want %v", val, errBoom)
+	}
+	if val, loaded := m.GetOrSet("nil", errBoom); !loaded || val != nil {
+		t.Errorf("GetOrSet() = %v, %v, want %v, %v", val, loaded, nil, true)
+	}
+	if val, loaded := m.GetOrSet("stored", nil); loaded || val != nil {
+		t.Errorf("GetOrSet() on a fresh key = %v, %v, want %v, %v", val, loaded, nil, false)
+	}
+
+	visited := 0
+	m.Range(func(key string, val error) bool {
+		if val != nil {
+			t.Errorf("Range() value for %q = %v, want %v", key, val, nil)
+		}
+		visited++
+		return true
+	})
+	if visited != 2 {
+		t.Errorf("Range() visited %d entries, want %d", visited, 2)
+	}
+	if res := m.ToMap(); len(res) != 2 || res["nil"] != nil {
+		t.Errorf("ToMap() = %v, want two nil values", res)
+	}
+
+	if prev, loaded := m.Swap("nil", errBoom); !loaded || prev != nil {
+		t.Errorf("Swap() = %v, %v, want %v, %v", prev, loaded, nil, true)
+	}
+	if prev, loaded := m.Swap("missing", nil); loaded || prev != nil {
+		t.Errorf("Swap() on a missing key = %v, %v, want %v, %v", prev, loaded, nil, false)
+	}
+	if !m.CompareAndSwap("missing", nil, errBoom) {
+		t.Errorf("CompareAndSwap() with a nil old value = %v, want %v", false, true)
+	}
+	if !m.CompareAndDelete("stored", nil) {
+		t.Errorf("CompareAndDelete() with a nil old value = %v, want %v", false, true)
+	}
+
+	m.Set("nil", nil)
+	if val, loaded := m.GetAndDelete("nil"); !loaded || val != nil {
+		t.Errorf("GetAndDelete() = %v, %v, want %v, %v", val, loaded, nil, true)
+	}
+	if val, loaded := m.GetAndDelete("nil"); loaded || val != nil {
+		t.Errorf("GetAndDelete() on a missing key = %v, %v, want %v, %v", val, loaded, nil, false)
+	}
+}
+
+func TestSyncMapNilInterfaceKeys(t *testing.T) {
+	m := &SyncMap[any, int]{}
+	m.Set(nil, 1)
+	if val, ok := m.Get(nil); !ok || val != 1 {
+		t.Errorf("Get(nil) = %v, %v, want %v, %v", val, ok, 1, true)
+	}
+	if keys := m.Keys(); len(keys) != 1 || keys[0] != nil {
+		t.Errorf("Keys() = %v, want [<nil>]", keys)
+	}
+}
+
 // Concurrent Tests
 func TestSyncMapConcurrentOperations(t *testing.T) {
 	m := &SyncMap[string, int]{}
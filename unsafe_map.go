@@ -0,0 +1,59 @@
+package safemap
+
+// UnsafeMap is a view of a SafeMap whose methods take no locks.
+//
+// It is only for phases in which a single goroutine uses the map, such as
+// a bulk load before the map is shared. Using an UnsafeMap while any other
+// goroutine uses the map, through the view or the SafeMap, is a data race
+// and its behavior is undefined: it can corrupt the map or crash the
+// program. Entry counts and the OnSet and OnDelete observers are
+// maintained as by the SafeMap's methods.
+type UnsafeMap[K comparable, V any] struct {
+	m *SafeMap[K, V]
+}
+
+// Unsafe returns a view of the map that skips all locking.
+// See UnsafeMap for when it may be used.
+func (m *SafeMap[K, V]) Unsafe() UnsafeMap[K, V] {
+	return UnsafeMap[K, V]{m: m}
+}
+
+// bucket returns the bucket holding key and its table
+func (u UnsafeMap[K, V]) bucket(key K) (*bucketMap[K, V], *bucketTable[K, V]) {
+	t := u.m.table.Load()
+	return t.buckets[t.index(key)], t
+}
+
+// Get returns key's value
+func (u UnsafeMap[K, V]) Get(key K) (V, bool) {
+	bucket, t := u.bucket(key)
+	val, b := bucket.innerMap[key]
+	if b {
+		val = t.read(val)
+	}
+	return val, b
+}
+
+// Set sets key's value
+func (u UnsafeMap[K, V]) Set(key K, val V) {
+	bucket, t := u.bucket(key)
+	if _, b := bucket.innerMap[key]; !b {
+		bucket.count++
+	}
+	bucket.innerMap[key] = val
+	t.notifySet(key)
+	if t.overloaded(bucket) {
+		u.m.grow(t)
+	}
+}
+
+// Delete deletes key
+func (u UnsafeMap[K, V]) Delete(key K) {
+	bucket, t := u.bucket(key)
+	if _, b := bucket.innerMap[key]; b {
+		delete(bucket.innerMap, key)
+		bucket.count--
+		bucket.cancelExpiry(key)
+		t.notifyDelete(key)
+	}
+}
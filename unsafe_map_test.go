@@ -0,0 +1,38 @@
+package safemap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnsafe(t *testing.T) {
+	var sets, deletes int
+	m := NewIntegerMap[int, int](
+		WithBuckets[int](0),
+		WithLoadFactor[int](8),
+		WithOnSet(func(int) { sets++ }),
+		WithOnDelete(func(int) { deletes++ }),
+	)
+	u := m.Unsafe()
+	for i := 0; i < 100; i++ {
+		u.Set(i, i)
+	}
+	u.Set(0, -1)
+	u.Delete(1)
+	u.Delete(1000)
+
+	val, ok := u.Get(0)
+	assert.True(t, ok)
+	assert.Equal(t, -1, val)
+	_, ok = u.Get(1)
+	assert.False(t, ok)
+	assert.Equal(t, 101, sets)
+	assert.Equal(t, 1, deletes)
+
+	// the locked map sees the same entries and counts
+	assert.Equal(t, 99, m.Len())
+	assert.Greater(t, m.BucketCount(), 1)
+	val, _ = m.Get(50)
+	assert.Equal(t, 50, val)
+}
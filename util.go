@@ -1,6 +1,22 @@
 package safemap
 
-import "github.com/cespare/xxhash/v2"
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"math"
+	"reflect"
+	"unsafe"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// maphashSeed is the process-wide seed for maphash based hashing
+var maphashSeed = maphash.MakeSeed()
 
 func Hashstr(s string) uint64 {
 	return xxhash.Sum64String(s)
@@ -9,3 +25,152 @@ func Hashstr(s string) uint64 {
 func Hash(b []byte) uint64 {
 	return xxhash.Sum64(b)
 }
+
+// HashFNV returns the 64-bit FNV-1a hash of s
+func HashFNV(s string) uint64 {
+	h := uint64(fnvOffset64)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime64
+	}
+	return h
+}
+
+// HashMaphash returns the runtime's maphash of s.
+// The seed is chosen randomly per process, so results are stable only
+// within a single run.
+func HashMaphash(s string) uint64 {
+	return maphash.String(maphashSeed, s)
+}
+
+// hashWithSeed rehashes h with a seeded xxhash
+func hashWithSeed(h, seed uint64) uint64 {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], h)
+	var d xxhash.Digest
+	d.ResetWithSeed(seed)
+	d.Write(buf[:])
+	return d.Sum64()
+}
+
+// mix64 is the murmur3 64-bit finalizer, spreading entropy into the low bits
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// hashFloat hashes f by its bit pattern, folding -0 into +0 since both
+// are equal as map keys
+func hashFloat(f float64) uint64 {
+	if f == 0 {
+		f = 0
+	}
+	return mix64(math.Float64bits(f))
+}
+
+// DefaultHashFunc returns a hash function for any comparable key type,
+// built on hash/maphash with the process-wide seed, so results are stable
+// only within a single run. Strings, integers, booleans and pointers are
+// hashed from their memory, floats by value with -0 folded into +0, and
+// other types, like structs, arrays and interfaces, as HashStruct does.
+//
+//	m, err := NewMap[K, V](WithHashFunc(DefaultHashFunc[K]()))
+func DefaultHashFunc[K comparable]() func(K) uint64 {
+	var zero K
+	size := unsafe.Sizeof(zero)
+	switch reflect.TypeOf(&zero).Elem().Kind() {
+	case reflect.String:
+		return func(k K) uint64 {
+			return maphash.String(maphashSeed, *(*string)(unsafe.Pointer(&k)))
+		}
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Pointer, reflect.UnsafePointer, reflect.Chan:
+		return func(k K) uint64 {
+			return maphash.Bytes(maphashSeed, unsafe.Slice((*byte)(unsafe.Pointer(&k)), size))
+		}
+	case reflect.Float32, reflect.Float64:
+		return func(k K) uint64 {
+			var f float64
+			if size == 4 {
+				f = float64(*(*float32)(unsafe.Pointer(&k)))
+			} else {
+				f = *(*float64)(unsafe.Pointer(&k))
+			}
+			var buf [8]byte
+			binary.LittleEndian.PutUint64(buf[:], hashFloat(f))
+			return maphash.Bytes(maphashSeed, buf[:])
+		}
+	default:
+		return HashStruct[K]()
+	}
+}
+
+// HashStruct returns a hash function for comparable struct keys.
+// It walks the key's fields with reflection and feeds them to hash/maphash,
+// so it is safe for structs with string, pointer, array, interface and
+// nested struct fields. Equal keys always hash equally.
+func HashStruct[K comparable]() func(K) uint64 {
+	return func(k K) uint64 {
+		var h maphash.Hash
+		h.SetSeed(maphashSeed)
+		writeHash(&h, reflect.ValueOf(k))
+		return h.Sum64()
+	}
+}
+
+// writeHash writes the comparable value v into h
+func writeHash(h *maphash.Hash, v reflect.Value) {
+	var buf [8]byte
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			h.WriteByte(1)
+		} else {
+			h.WriteByte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		binary.LittleEndian.PutUint64(buf[:], uint64(v.Int()))
+		h.Write(buf[:])
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		binary.LittleEndian.PutUint64(buf[:], v.Uint())
+		h.Write(buf[:])
+	case reflect.Float32, reflect.Float64:
+		binary.LittleEndian.PutUint64(buf[:], hashFloat(v.Float()))
+		h.Write(buf[:])
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		binary.LittleEndian.PutUint64(buf[:], hashFloat(real(c)))
+		h.Write(buf[:])
+		binary.LittleEndian.PutUint64(buf[:], hashFloat(imag(c)))
+		h.Write(buf[:])
+	case reflect.String:
+		// length prefix keeps adjacent string fields from running together
+		binary.LittleEndian.PutUint64(buf[:], uint64(v.Len()))
+		h.Write(buf[:])
+		h.WriteString(v.String())
+	case reflect.Pointer, reflect.UnsafePointer, reflect.Chan:
+		binary.LittleEndian.PutUint64(buf[:], uint64(v.Pointer()))
+		h.Write(buf[:])
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			writeHash(h, v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			writeHash(h, v.Field(i))
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			h.WriteByte(0)
+		} else {
+			h.WriteByte(1)
+			writeHash(h, v.Elem())
+		}
+	}
+}